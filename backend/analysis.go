@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// analysisURL is the bot's analysis service (see BOT_ANALYSIS_ADDR in the bot); ANALYSIS_URL
+// overrides it.
+var analysisURL = "http://localhost:8081"
+
+const (
+	// analysisTimeout bounds a request to the analysis service, which keeps its own time budget.
+	analysisTimeout = 10 * time.Second
+	maxAnalysisTop  = 10
+)
+
+type AnalysisRequest struct {
+	State *State `json:"state"`
+	// Top is the number of candidate moves wanted; the service picks when it is zero.
+	Top int `json:"top"`
+	// TimeMs shortens the service's thinking time when it is not zero.
+	TimeMs int `json:"time_ms,omitempty"`
+}
+
+var ErrAnalysisUnavailable = errors.New("Analysis is unavailable")
+
+// RequestAnalysis forwards a request to the analysis service and returns its status and body
+// as they are.
+func RequestAnalysis(ctx context.Context, request AnalysisRequest) (int, []byte, error) {
+	return postAnalysisService(ctx, "/analyze", request)
+}
+
+// GameAnalysisRequest asks for the analysis of a position of a game: Id is one of its players'
+// ids, and Ply the number of moves played before the position, the current one when nil. A
+// position set up away from any game is sent as State instead of Id and Ply.
+type GameAnalysisRequest struct {
+	Id    int64  `json:"id"`
+	Ply   *int   `json:"ply"`
+	State *State `json:"state"`
+	Top   int    `json:"top"`
+}
+
+// AnalyzeGame has the analysis service analyze a position of a game, as RequestAnalysis does.
+// Finished games can be analyzed at any ply, but games still being played only if they are
+// unrated, so that nobody gets the engine's help in a rated game. For the same reason a
+// submitted position is refused while it is the current one of a rated game.
+func AnalyzeGame(ctx context.Context, db *sql.DB, request GameAnalysisRequest) (int, []byte, error) {
+	if request.Top < 0 || request.Top > maxAnalysisTop {
+		return 0, nil, errors.New("Invalid number of candidate moves")
+	}
+	if request.State != nil {
+		if request.Id != 0 || request.Ply != nil {
+			return 0, nil, errors.New("Either a game or a position can be analyzed, not both")
+		}
+		return analyzePosition(ctx, db, request.State, request.Top)
+	}
+	transaction, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	current, _, err := GetState(transaction, request.Id)
+	if err != nil {
+		transaction.Rollback()
+		return 0, nil, err
+	}
+	info, err := GetGameInfo(transaction, request.Id)
+	if err != nil {
+		transaction.Rollback()
+		return 0, nil, err
+	}
+	moves, err := GetMoves(transaction, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return 0, nil, err
+	}
+	// The service is not asked inside the transaction, which would hold up the database.
+	transaction.Rollback()
+	if info.Options.Rated && !current.IsOver() {
+		return 0, nil, errors.New("Rated games can only be analyzed once they are over")
+	}
+
+	ply := len(moves)
+	if request.Ply != nil {
+		ply = *request.Ply
+	}
+	state, err := replays.StateAt(info.GameId, info.Options.Rules, moves, ply)
+	if err != nil {
+		return 0, nil, err
+	}
+	if state.IsOver() {
+		return 0, nil, errors.New("The game is over")
+	}
+	return RequestAnalysis(ctx, AnalysisRequest{State: &state, Top: request.Top})
+}
+
+// analyzePosition has the analysis service analyze a submitted position, whose shape was checked
+// against its rules when it was parsed.
+func analyzePosition(ctx context.Context, db *sql.DB, state *State, top int) (int, []byte, error) {
+	if state.IsOver() {
+		return 0, nil, errors.New("The game is over")
+	}
+	stateString, err := json.Marshal(*state)
+	if err != nil {
+		return 0, nil, err
+	}
+	var rated int
+	err = db.QueryRow(`SELECT COUNT(*) FROM games WHERE rated = 1 AND state = ?`, string(stateString)).Scan(&rated)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rated > 0 {
+		return 0, nil, errors.New("Rated games can only be analyzed once they are over")
+	}
+	return RequestAnalysis(ctx, AnalysisRequest{State: state, Top: top})
+}
+
+// Solution is a position the analysis service solved: the outcome for the side to move ("win",
+// "draw" or "loss"), the plies to a won or lost end, and the line played out with best play.
+type Solution struct {
+	Outcome  string `json:"outcome"`
+	Distance int    `json:"distance"`
+	Line     []Move `json:"line"`
+}
+
+const (
+	OutcomeWin  = "win"
+	OutcomeLoss = "loss"
+)
+
+// RequestSolution has the analysis service solve state within timeMs. It fails with
+// ErrNotSolved when the service runs out of time, and ErrAnalysisBusy when it is solving or
+// analyzing other positions.
+func RequestSolution(ctx context.Context, state *State, timeMs int) (*Solution, error) {
+	status, body, err := postAnalysisService(ctx, "/solve", AnalysisRequest{State: state, TimeMs: timeMs})
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusServiceUnavailable:
+		return nil, ErrNotSolved
+	case http.StatusTooManyRequests:
+		return nil, ErrAnalysisBusy
+	}
+	if status != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &answer) != nil || answer.Error == "" {
+			return nil, ErrAnalysisUnavailable
+		}
+		return nil, errors.New(answer.Error)
+	}
+	var solution Solution
+	if err := json.Unmarshal(body, &solution); err != nil {
+		return nil, ErrAnalysisUnavailable
+	}
+	return &solution, nil
+}
+
+var (
+	ErrNotSolved    = errors.New("Position could not be solved in time")
+	ErrAnalysisBusy = errors.New("Analysis is busy, try again later")
+)
+
+func postAnalysisService(ctx context.Context, path string, request AnalysisRequest) (int, []byte, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, analysisTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, analysisURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, ErrAnalysisUnavailable
+	}
+	defer res.Body.Close()
+	answer, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, ErrAnalysisUnavailable
+	}
+	return res.StatusCode, answer, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeAnalysisService points the backend to handler instead of the bot's analysis service.
+func fakeAnalysisService(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	saved := analysisURL
+	analysisURL = server.URL
+	t.Cleanup(func() {
+		analysisURL = saved
+		server.Close()
+	})
+}
+
+func TestAnalyzeGame(t *testing.T) {
+	db := testDatabase(t)
+	var analyzed []State
+	fakeAnalysisService(t, func(w http.ResponseWriter, r *http.Request) {
+		var request AnalysisRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		analyzed = append(analyzed, *request.State)
+		w.Write([]byte(`{"candidates":[]}`))
+	})
+	finished, finishedMoves := randomGame(t, ClassicRules, 7, 81)
+	if !finished.IsOver() {
+		t.Fatal("the game didn't finish")
+	}
+	_, ongoingMoves := randomGame(t, ClassicRules, 8, 6)
+
+	newGame := func(rated bool, moves []Move) int64 {
+		_, crossId, circleId, err := CreateGame(db, GameOptions{Rated: rated, Rules: ClassicRules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		playMoves(t, db, crossId, circleId, moves)
+		return circleId
+	}
+	ratedFinished := newGame(true, finishedMoves)
+	ratedOngoing := newGame(true, ongoingMoves)
+	unratedOngoing := newGame(false, ongoingMoves)
+	ply := func(n int) *int { return &n }
+	position := func(moves []Move) *State {
+		state, _ := ReplayMoves(ClassicRules, moves)
+		return &state
+	}
+
+	tests := []struct {
+		name    string
+		request GameAnalysisRequest
+		moves   []Move // the position analyzed is after these, when it is allowed
+	}{
+		{"rated finished", GameAnalysisRequest{Id: ratedFinished, Ply: ply(10)}, finishedMoves[:10]},
+		{"rated finished at the start", GameAnalysisRequest{Id: ratedFinished, Ply: ply(0)}, finishedMoves[:0]},
+		{"rated finished at the end", GameAnalysisRequest{Id: ratedFinished}, nil},
+		{"rated ongoing", GameAnalysisRequest{Id: ratedOngoing, Ply: ply(2)}, nil},
+		{"unrated ongoing", GameAnalysisRequest{Id: unratedOngoing}, ongoingMoves},
+		{"unrated ongoing earlier", GameAnalysisRequest{Id: unratedOngoing, Ply: ply(3)}, ongoingMoves[:3]},
+		{"past the end", GameAnalysisRequest{Id: unratedOngoing, Ply: ply(7)}, nil},
+		{"unknown game", GameAnalysisRequest{Id: 12345}, nil},
+		{"too many candidates", GameAnalysisRequest{Id: unratedOngoing, Top: maxAnalysisTop + 1}, nil},
+		{"position", GameAnalysisRequest{State: position(ongoingMoves[:4])}, ongoingMoves[:4]},
+		{"position of a finished game", GameAnalysisRequest{State: position(finishedMoves[:20])}, finishedMoves[:20]},
+		{"position at the end", GameAnalysisRequest{State: &finished}, nil},
+		// The current position of a rated game, even if an unrated game has it too.
+		{"position of a rated ongoing game", GameAnalysisRequest{State: position(ongoingMoves)}, nil},
+		{"position and game", GameAnalysisRequest{Id: unratedOngoing, State: position(ongoingMoves[:4])}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analyzed = nil
+			status, _, err := AnalyzeGame(context.Background(), db, test.request)
+			if test.moves == nil {
+				if err == nil || len(analyzed) > 0 {
+					t.Fatalf("analyzed %d positions, want an error", len(analyzed))
+				}
+				return
+			}
+			if err != nil || status != 200 {
+				t.Fatalf("status %d, error %v", status, err)
+			}
+			want, _ := ReplayMoves(ClassicRules, test.moves)
+			if len(analyzed) != 1 || !reflect.DeepEqual(analyzed[0], want) {
+				t.Fatal("the service didn't get the position at the ply")
+			}
+		})
+	}
+}
+
+func TestGameAnalysisRequestState(t *testing.T) {
+	noBoards := State{Rules: ClassicRules, Winner: None, Location: -1}
+	nobodyToMove := NewState(ClassicRules)
+	nobodyToMove.ToMove = None
+	for _, state := range []State{NewState(ClassicRules), noBoards, nobodyToMove} {
+		text, _ := json.Marshal(GameAnalysisRequest{State: &state})
+		var request GameAnalysisRequest
+		err := json.Unmarshal(text, &request)
+		if valid := state.Values != nil && state.ToMove != None; (err == nil) != valid {
+			t.Errorf("parsing %s: error %v", text, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// botSeatTimeout is how long a seat waits for the bot, which claims seats every second while
+	// it runs.
+	botSeatTimeout = 30 * time.Second
+	// abandonedBotGameTTL is how long players of games the bot never joined are told so.
+	abandonedBotGameTTL = 1 * time.Hour
+)
+
+var ErrBotAbsent = errors.New("The bot didn't join the game, start a new one")
+
+type botSeat struct {
+	seat     MyState
+	playerId int64
+	created  time.Time
+}
+
+// Seats of games players started against the bot, waiting for the bot to claim them, oldest
+// first. They are only kept in memory: after a restart, the players of unclaimed games have to
+// start new ones.
+var (
+	botSeatsMutex     sync.Mutex
+	botSeats          []botSeat
+	abandonedBotGames = map[int64]time.Time{} // by player id, when the seat expired
+)
+
+// CreateBotGame starts a game against the bot; the player plays Cross and the bot's seat waits
+// for ClaimBotSeat.
+func CreateBotGame(db *sql.DB, options GameOptions) (MyState, error) {
+	state, crossId, circleId, err := CreateGame(db, options)
+	if err != nil {
+		return MyState{}, err
+	}
+	botSeatsMutex.Lock()
+	seat := MyState{Id: circleId, GameState: *state, Role: Circle, Options: options, Takeback: None}
+	botSeats = append(botSeats, botSeat{seat: seat, playerId: crossId, created: time.Now()})
+	botSeatsMutex.Unlock()
+	return MyState{Id: crossId, GameState: *state, Role: Cross, Options: options, Takeback: None}, nil
+}
+
+// ClaimBotSeat hands the oldest waiting seat to the bot.
+func ClaimBotSeat() (MyState, bool) {
+	botSeatsMutex.Lock()
+	defer botSeatsMutex.Unlock()
+	expireBotSeats(time.Now())
+	if len(botSeats) == 0 {
+		return MyState{}, false
+	}
+	seat := botSeats[0]
+	botSeats = botSeats[1:]
+	return seat.seat, true
+}
+
+// BotGameAbandoned reports whether id plays a game whose seat the bot didn't claim in time.
+func BotGameAbandoned(id int64) bool {
+	botSeatsMutex.Lock()
+	defer botSeatsMutex.Unlock()
+	expireBotSeats(time.Now())
+	_, ok := abandonedBotGames[id]
+	return ok
+}
+
+// expireBotSeats drops the seats that waited longer than botSeatTimeout at now, and forgets the
+// games abandoned longer than abandonedBotGameTTL ago. The caller holds botSeatsMutex.
+func expireBotSeats(now time.Time) {
+	for len(botSeats) > 0 && now.Sub(botSeats[0].created) > botSeatTimeout {
+		abandonedBotGames[botSeats[0].playerId] = now
+		botSeats = botSeats[1:]
+	}
+	for id, expired := range abandonedBotGames {
+		if now.Sub(expired) > abandonedBotGameTTL {
+			delete(abandonedBotGames, id)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resetBotSeats empties the seats waiting for the bot, for a test and after it.
+func resetBotSeats(t *testing.T) {
+	reset := func() {
+		botSeatsMutex.Lock()
+		botSeats, abandonedBotGames = nil, map[int64]time.Time{}
+		botSeatsMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestClaimBotGameSecret(t *testing.T) {
+	db := testDatabase(t)
+	resetBotSeats(t)
+	if _, err := CreateBotGame(db, GameOptions{Rules: ClassicRules, BotLevel: "easy"}); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/play/bot", claimBotGame)
+	claim := func(secret string) int {
+		request := httptest.NewRequest("POST", "/play/bot", nil)
+		if secret != "" {
+			request.Header.Set("X-Bot-Secret", secret)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	botSecret = ""
+	if code := claim(""); code != 403 {
+		t.Fatalf("claim without a secret configured: status %d, want 403", code)
+	}
+	botSecret = "s3cret"
+	t.Cleanup(func() { botSecret = "" })
+	for _, secret := range []string{"", "wrong"} {
+		if code := claim(secret); code != 403 {
+			t.Fatalf("claim with secret %q: status %d, want 403", secret, code)
+		}
+	}
+	if code := claim("s3cret"); code != 200 {
+		t.Fatalf("claim with the secret: status %d, want 200", code)
+	}
+	if code := claim("s3cret"); code != 204 {
+		t.Fatalf("claim with no seat waiting: status %d, want 204", code)
+	}
+}
+
+func TestBotSeatsExpire(t *testing.T) {
+	db := testDatabase(t)
+	resetBotSeats(t)
+	player, err := CreateBotGame(db, GameOptions{Rules: ClassicRules, BotLevel: "easy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BotGameAbandoned(player.Id) {
+		t.Fatal("a new game is abandoned")
+	}
+
+	botSeatsMutex.Lock()
+	expireBotSeats(time.Now().Add(botSeatTimeout + time.Second))
+	botSeatsMutex.Unlock()
+	if _, ok := ClaimBotSeat(); ok {
+		t.Fatal("claimed an expired seat")
+	}
+	if !BotGameAbandoned(player.Id) {
+		t.Fatal("the player of an expired seat isn't told")
+	}
+
+	botSeatsMutex.Lock()
+	expireBotSeats(time.Now().Add(abandonedBotGameTTL + time.Minute))
+	botSeatsMutex.Unlock()
+	if BotGameAbandoned(player.Id) {
+		t.Fatal("abandoned games are never forgotten")
+	}
+}
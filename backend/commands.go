@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// runCommand handles the command-line tools that run instead of the HTTP server.
+func runCommand(db *sql.DB, args []string) error {
+	switch args[0] {
+	case "import":
+		return importCommand(db, args[1:])
+	case "mine-puzzles":
+		return minePuzzlesCommand(db)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// importCommand validates and stores game records, printing the ids the imported games can be opened with.
+func importCommand(db *sql.DB, files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("usage: import <record file>...")
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		record, err := ParseRecord(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		crossId, circleId, err := ImportGame(db, record)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		fmt.Printf("imported %s: moves=%d result=%s cross_id=%d circle_id=%d\n",
+			file, len(record.Moves), record.Result, crossId, circleId)
+	}
+	return nil
+}
+
+// minePuzzlesCommand looks for puzzles in the finished games not mined yet; the analysis service must be up.
+func minePuzzlesCommand(db *sql.DB) error {
+	games, puzzles, err := MinePuzzles(context.Background(), db)
+	fmt.Printf("mined puzzles: games=%d puzzles=%d\n", games, puzzles)
+	return err
+}
@@ -35,25 +35,127 @@ func SetUpDatabase() (*sql.DB, error) {
 		db.Close()
 		return nil, err
 	}
+	// Games created before the move log existed have no creation time; they report it as 0.
+	err = addColumnIfMissing(db, "games", "created_at", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = addColumnIfMissing(db, "games", "rated", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = addColumnIfMissing(db, "games", "takeback_by", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", None))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = addColumnIfMissing(db, "games", "bot_level", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The number of hints each player took.
+	for _, column := range []string{"cross_hints", "circle_hints"} {
+		err = addColumnIfMissing(db, "games", column, "INTEGER NOT NULL DEFAULT 0")
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	// Whether the game was searched for a puzzle yet.
+	err = addColumnIfMissing(db, "games", "puzzles_mined", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Every accepted move, keyed by the cross id of its game, so finished games can be replayed.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS moves (
+			game_id INTEGER,
+			ply INTEGER,
+			player INTEGER,
+			cell_x INTEGER,
+			cell_y INTEGER,
+			mid_x INTEGER NOT NULL DEFAULT 0,
+			mid_y INTEGER NOT NULL DEFAULT 0,
+			final_x INTEGER,
+			final_y INTEGER,
+			PRIMARY KEY (game_id, ply));`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, column := range []string{"mid_x", "mid_y"} {
+		err = addColumnIfMissing(db, "moves", column, "INTEGER NOT NULL DEFAULT 0")
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	// Moves of two-level games have no middle board. PerformMove once ignored the coordinates
+	// instead of refusing them, so clear any that were logged; states without rules are classic.
+	_, err = db.Exec(`UPDATE moves SET mid_x = 0, mid_y = 0 WHERE (mid_x != 0 OR mid_y != 0) AND game_id IN
+			(SELECT cross_id FROM games WHERE IFNULL(NULLIF(json_extract(state, '$.rules.depth'), 0), 2) = 2);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Positions of finished games with a forced win, at most one per game; they outlive the games.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS puzzles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			game_id INTEGER UNIQUE,
+			ply INTEGER,
+			state TEXT,
+			solution TEXT,
+			plies INTEGER);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 	return db, nil
 }
 
-func CreateGame(db *sql.DB) (*State, int64, int64, error) {
-	emptyLocal := LocalState{Winner: None}
-	for i := range 3 {
-		for j := range 3 {
-			emptyLocal.Values[i][j] = None
-		}
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
 	}
-	// IMPORTANT: Winner must start as None, otherwise the game is considered already finished
-	// and all moves will be rejected with "Game already finished".
-	state := State{ToMove: Cross, Winner: None}
-	for i := range 3 {
-		for j := range 3 {
-			state.Values[i][j] = emptyLocal
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
 		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	state.Location = -1
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func CreateGame(db *sql.DB, options GameOptions) (*State, int64, int64, error) {
+	return createGame(db, options)
+}
+
+// execer is a database or a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func createGame(db execer, options GameOptions) (*State, int64, int64, error) {
+	state := NewState(options.Rules)
 
 	// Seed PRNG from time to avoid repeating ID sequences across restarts.
 	seed := uint64(time.Now().UnixNano())
@@ -76,7 +178,8 @@ func CreateGame(db *sql.DB) (*State, int64, int64, error) {
 	if err != nil {
 		return &state, 0, 0, err
 	}
-	result, err := db.Exec(`INSERT INTO games(cross_id, circle_id, state) VALUES (?, ?, ?)`, crossId, circleId, string(stateString))
+	result, err := db.Exec(`INSERT INTO games(cross_id, circle_id, state, created_at, rated, bot_level, takeback_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		crossId, circleId, string(stateString), time.Now().Unix(), options.Rated, options.BotLevel, None)
 	if err != nil {
 		// Log the error for debugging
 		errorMsg := fmt.Sprintf("ERROR: Failed to insert game: %v (crossId: %d, circleId: %d, stateLen: %d)\n", err, crossId, circleId, len(stateString))
@@ -204,26 +307,211 @@ func MakeMove(db *sql.DB, id int64, move Move) (*State, error) {
 		transaction.Rollback()
 		return nil, err
 	}
+	// A move answers any pending takeback request by moving on.
 	if player == Circle {
-		_, err = transaction.Exec(`UPDATE games SET state = ? WHERE circle_id = ?`, string(stateString), id)
+		_, err = transaction.Exec(`UPDATE games SET state = ?, takeback_by = ? WHERE circle_id = ?`, string(stateString), None, id)
 	} else {
-		_, err = transaction.Exec(`UPDATE games SET state = ? WHERE cross_id = ?`, string(stateString), id)
+		_, err = transaction.Exec(`UPDATE games SET state = ?, takeback_by = ? WHERE cross_id = ?`, string(stateString), None, id)
 	}
 	if err != nil {
 		transaction.Rollback()
 		return nil, err
 	}
+	gameId, err := GetGameId(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	err = AppendMove(transaction, gameId, move)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
 	err = transaction.Commit()
 	if err != nil {
 		return nil, err
 	}
 	return state, nil
 }
+
+// GetGameId maps either player's id to the id the move log is keyed by (the cross id).
+func GetGameId(transaction *sql.Tx, id int64) (int64, error) {
+	var gameId int64
+	err := transaction.QueryRow(`SELECT cross_id FROM games WHERE cross_id = ? OR circle_id = ?`, id, id).Scan(&gameId)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("Not a valid game")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return gameId, nil
+}
+
+// GameInfo is what is stored about a game besides its state.
+type GameInfo struct {
+	GameId   int64
+	Options  GameOptions
+	Takeback Player
+}
+
+func GetGameInfo(transaction *sql.Tx, id int64) (*GameInfo, error) {
+	var info GameInfo
+	var stateString string
+	err := transaction.QueryRow(`SELECT cross_id, rated, bot_level, takeback_by, state FROM games WHERE cross_id = ? OR circle_id = ?`, id, id).
+		Scan(&info.GameId, &info.Options.Rated, &info.Options.BotLevel, &info.Takeback, &stateString)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("Not a valid game")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The rules travel with the state.
+	var state State
+	err = json.Unmarshal([]byte(stateString), &state)
+	if err != nil {
+		return nil, err
+	}
+	info.Options.Rules = state.Rules
+	return &info, nil
+}
+
+func AppendMove(transaction *sql.Tx, gameId int64, move Move) error {
+	var ply int
+	err := transaction.QueryRow(`SELECT COUNT(*) FROM moves WHERE game_id = ?`, gameId).Scan(&ply)
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(`INSERT INTO moves(game_id, ply, player, cell_x, cell_y, mid_x, mid_y, final_x, final_y) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		gameId, ply, move.Player, move.CellX, move.CellY, move.MidX, move.MidY, move.FinalX, move.FinalY)
+	return err
+}
+
+// GetMoves returns the move log of a game in the order the moves were played.
+func GetMoves(transaction *sql.Tx, gameId int64) ([]Move, error) {
+	rows, err := transaction.Query(`SELECT player, cell_x, cell_y, mid_x, mid_y, final_x, final_y FROM moves WHERE game_id = ? ORDER BY ply`, gameId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	moves := []Move{}
+	for rows.Next() {
+		var move Move
+		err = rows.Scan(&move.Player, &move.CellX, &move.CellY, &move.MidX, &move.MidY, &move.FinalX, &move.FinalY)
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, move)
+	}
+	return moves, rows.Err()
+}
+
+func GetCreatedAt(transaction *sql.Tx, gameId int64) (time.Time, error) {
+	var createdAt int64
+	err := transaction.QueryRow(`SELECT created_at FROM games WHERE cross_id = ?`, gameId).Scan(&createdAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if createdAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(createdAt, 0), nil
+}
+
+// GetHints returns the number of hints each player of a game took, indexed by Player.
+func GetHints(transaction *sql.Tx, gameId int64) ([2]int, error) {
+	var hints [2]int
+	err := transaction.QueryRow(`SELECT cross_hints, circle_hints FROM games WHERE cross_id = ?`, gameId).Scan(&hints[Cross], &hints[Circle])
+	return hints, err
+}
+
+func GetRecord(transaction *sql.Tx, id int64) (*GameRecord, error) {
+	state, _, err := GetState(transaction, id)
+	if err != nil {
+		return nil, err
+	}
+	gameId, err := GetGameId(transaction, id)
+	if err != nil {
+		return nil, err
+	}
+	moves, err := GetMoves(transaction, gameId)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := GetCreatedAt(transaction, gameId)
+	if err != nil {
+		return nil, err
+	}
+	hints, err := GetHints(transaction, gameId)
+	if err != nil {
+		return nil, err
+	}
+	return &GameRecord{
+		Rules:       state.Rules,
+		Cross:       unknownPlayer,
+		Circle:      unknownPlayer,
+		Result:      ResultOf(*state),
+		Date:        createdAt,
+		TimeControl: noTimeControl,
+		Hints:       hints,
+		Moves:       moves,
+	}, nil
+}
+
+// ImportGame stores a replayed game record as a new game and returns the ids of both sides.
+func ImportGame(db *sql.DB, record *GameRecord) (int64, int64, error) {
+	state, err := record.Replay()
+	if err != nil {
+		return 0, 0, err
+	}
+	stateString, err := json.Marshal(state)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The game is created in the same transaction as its moves, so a failed import leaves nothing.
+	transaction, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	_, crossId, circleId, err := createGame(transaction, GameOptions{Rules: record.Rules})
+	if err != nil {
+		transaction.Rollback()
+		return 0, 0, err
+	}
+	var createdAt int64
+	if !record.Date.IsZero() {
+		createdAt = record.Date.Unix()
+	}
+	_, err = transaction.Exec(`UPDATE games SET state = ?, created_at = ?, cross_hints = ?, circle_hints = ? WHERE cross_id = ?`,
+		string(stateString), createdAt, record.Hints[Cross], record.Hints[Circle], crossId)
+	if err != nil {
+		transaction.Rollback()
+		return 0, 0, err
+	}
+	for _, move := range record.Moves {
+		err = AppendMove(transaction, crossId, move)
+		if err != nil {
+			transaction.Rollback()
+			return 0, 0, err
+		}
+	}
+	err = transaction.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	return crossId, circleId, nil
+}
+
 func CleanupDatabase(db *sql.DB) {
 	db.Close()
 }
 
+// ClearGames deletes all games and their moves, except the won games not mined for puzzles yet,
+// which are kept until a later MinePuzzles gets to them.
 func ClearGames(db *sql.DB) error {
-	_, err := db.Exec(`DELETE FROM games;`)
+	_, err := db.Exec(`DELETE FROM games WHERE puzzles_mined = 1 OR json_extract(state, '$.winner') = ?;`, None)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM moves WHERE game_id NOT IN (SELECT cross_id FROM games);`)
 	return err
 }
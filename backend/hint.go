@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// hintTimeMs is the engine's thinking time for a hint: enough for a good move, short enough
+// not to hold up the game.
+const hintTimeMs = 300
+
+type Hint struct {
+	Move     Move   `json:"move"`
+	Notation string `json:"notation"`
+	// Hints is the number of hints the player has taken in this game, this one included.
+	Hints int `json:"hints"`
+}
+
+// GetHint asks the engine for a move for the player behind id, who must be to move in an
+// unrated game, and counts the hint against them in the game record.
+func GetHint(ctx context.Context, db *sql.DB, id int64) (*Hint, error) {
+	transaction, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	state, player, err := GetState(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	info, err := GetGameInfo(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	// The engine is not asked inside the transaction, which would hold up the database.
+	transaction.Rollback()
+	if info.Options.Rated {
+		return nil, errors.New("Hints are disabled in rated games")
+	}
+	if state.IsOver() {
+		return nil, errors.New("Game already finished")
+	}
+	if state.ToMove != player {
+		return nil, errors.New("Not your turn")
+	}
+
+	status, body, err := RequestAnalysis(ctx, AnalysisRequest{State: state, Top: 1, TimeMs: hintTimeMs})
+	if err != nil {
+		return nil, err
+	}
+	var analysis struct {
+		Candidates []struct {
+			Move Move `json:"move"`
+		} `json:"candidates"`
+	}
+	// The service refuses positions only when it is busy or broken, never because of the player.
+	if status != 200 || json.Unmarshal(body, &analysis) != nil || len(analysis.Candidates) == 0 {
+		return nil, ErrAnalysisUnavailable
+	}
+	// The engine only suggests moves into the board State.Location sends the player to, but a
+	// hint must never be a move the game would refuse.
+	move := analysis.Candidates[0].Move
+	move.Player = player
+	if _, err := PerformMove(*state, move); err != nil {
+		return nil, fmt.Errorf("Engine suggested an illegal move: %v", err)
+	}
+
+	column := "cross_hints"
+	if player == Circle {
+		column = "circle_hints"
+	}
+	transaction, err = db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// The hint only counts if it is still for the position the player is in.
+	now, _, err := GetState(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	if !reflect.DeepEqual(now, state) {
+		transaction.Rollback()
+		return nil, errors.New("The game moved on, ask again")
+	}
+	_, err = transaction.Exec(fmt.Sprintf(`UPDATE games SET %s = %s + 1 WHERE cross_id = ?`, column, column), info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	hints, err := GetHints(transaction, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	err = transaction.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &Hint{Move: move, Notation: MoveNotation(state.Rules, move), Hints: hints[player]}, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// suggestFirstMove answers analysis requests with the first legal move, after calling before if
+// it is not nil.
+func suggestFirstMove(t *testing.T, before func(state State)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request AnalysisRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		if before != nil {
+			before(*request.State)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"candidates": []map[string]any{{"move": legalMoves(*request.State)[0]}},
+		})
+	}
+}
+
+func hintCount(t *testing.T, db *sql.DB, id int64) [2]int {
+	t.Helper()
+	transaction, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transaction.Rollback()
+	info, err := GetGameInfo(transaction, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints, err := GetHints(transaction, info.GameId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hints
+}
+
+func TestGetHint(t *testing.T) {
+	db := testDatabase(t)
+	fakeAnalysisService(t, suggestFirstMove(t, nil))
+	_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for want := 1; want <= 2; want++ {
+		hint, err := GetHint(context.Background(), db, crossId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hint.Hints != want || hint.Notation != "a1" {
+			t.Fatalf("hint %+v, want a1 as hint %d", hint, want)
+		}
+	}
+	if _, err := GetHint(context.Background(), db, circleId); err == nil {
+		t.Fatal("gave a hint to the player not to move")
+	}
+	if hints := hintCount(t, db, crossId); hints != [2]int{2, 0} {
+		t.Fatalf("hints %v recorded, want [2 0]", hints)
+	}
+}
+
+func TestGetHintRefused(t *testing.T) {
+	db := testDatabase(t)
+	asked := 0
+	fakeAnalysisService(t, suggestFirstMove(t, func(State) { asked++ }))
+
+	_, ratedCross, _, err := CreateGame(db, GameOptions{Rated: true, Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetHint(context.Background(), db, ratedCross); err == nil {
+		t.Fatal("gave a hint in a rated game")
+	}
+
+	state, moves := randomGame(t, ClassicRules, 9, 81)
+	if !state.IsOver() {
+		t.Fatal("the game didn't finish")
+	}
+	_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playMoves(t, db, crossId, circleId, moves)
+	if _, err := GetHint(context.Background(), db, crossId); err == nil {
+		t.Fatal("gave a hint in a finished game")
+	}
+	if asked > 0 {
+		t.Fatalf("asked the engine %d times for refused hints", asked)
+	}
+}
+
+func TestGetHintNotCounted(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     func(db *sql.DB, crossId int64) http.HandlerFunc
+		unavailable bool // GetHint fails with ErrAnalysisUnavailable
+	}{
+		{"service busy", func(*sql.DB, int64) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error":"Analysis is busy, try again later"}`))
+			}
+		}, true},
+		{"service refusing", func(*sql.DB, int64) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Invalid state"}`))
+			}
+		}, true},
+		{"illegal move", func(*sql.DB, int64) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"candidates":[{"move":{"player":0,"cellX":7,"cellY":0,"finalX":0,"finalY":0}}]}`))
+			}
+		}, false},
+		// The player moves while the engine thinks.
+		{"game moved on", func(db *sql.DB, crossId int64) http.HandlerFunc {
+			return suggestFirstMove(t, func(state State) {
+				if _, err := MakeMove(db, crossId, legalMoves(state)[1]); err != nil {
+					t.Error(err)
+				}
+			})
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testDatabase(t)
+			_, crossId, _, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fakeAnalysisService(t, test.handler(db, crossId))
+			hint, err := GetHint(context.Background(), db, crossId)
+			if err == nil {
+				t.Fatalf("got hint %+v", hint)
+			}
+			if test.unavailable && err != ErrAnalysisUnavailable {
+				t.Fatalf("error %v, want %v", err, ErrAnalysisUnavailable)
+			}
+			if hints := hintCount(t, db, crossId); hints != [2]int{} {
+				t.Fatalf("hints %v recorded, want none", hints)
+			}
+		})
+	}
+}
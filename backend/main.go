@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"flag"
 	"log"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -14,9 +16,11 @@ import (
 
 var addr = flag.String("addr", ":8080", "http service address")
 var dbPointer *sql.DB
+
+// botSecret is what the bot sends in the X-Bot-Secret header to claim seats; while it is empty,
+// nobody can.
+var botSecret string
 var matchUpMutex sync.Mutex
-var first = false
-var matchEpoch uint64
 
 type matchMsg struct {
 	epoch uint64
@@ -24,38 +28,76 @@ type matchMsg struct {
 	err   string
 }
 
-// Buffer >1 helps avoid rare blocking if a stale message is left behind.
-var matchState chan matchMsg = make(chan matchMsg, 8)
+// matchSlot holds the player waiting for an opponent with the same options.
+type matchSlot struct {
+	first bool
+	epoch uint64
+	// Buffer >1 helps avoid rare blocking if a stale message is left behind.
+	state chan matchMsg
+}
+
+// Players are only paired with players that asked for the same options. Guarded by matchUpMutex.
+var matchSlots = map[GameOptions]*matchSlot{}
+
+func slotFor(options GameOptions) *matchSlot {
+	slot := matchSlots[options]
+	if slot == nil {
+		slot = &matchSlot{state: make(chan matchMsg, 8)}
+		matchSlots[options] = slot
+	}
+	return slot
+}
 
 func play(ctx *gin.Context) {
+	var options GameOptions
+	if err := ctx.ShouldBindQuery(&options); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid game options"})
+		return
+	}
+	options.Rules = options.Rules.WithDefaults()
+	if err := options.Validate(); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if options.BotLevel != "" {
+		state, err := CreateBotGame(dbPointer, options)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": "Couldn't create game"})
+			return
+		}
+		ctx.IndentedJSON(200, state)
+		return
+	}
+
 	matchUpMutex.Lock()
-	if first {
-		epoch := matchEpoch
-		state, myId, otherId, err := CreateGame(dbPointer)
+	slot := slotFor(options)
+	if slot.first {
+		epoch := slot.epoch
+		state, myId, otherId, err := CreateGame(dbPointer, options)
 		if err != nil || myId == 0 {
 			// Reset first so next player can try again, and unblock waiting player
-			first = false
+			slot.first = false
 			select {
-			case matchState <- matchMsg{epoch: epoch, err: "Couldn't create game"}:
+			case slot.state <- matchMsg{epoch: epoch, err: "Couldn't create game"}:
 			default:
 			}
 			matchUpMutex.Unlock()
 			ctx.JSON(500, gin.H{"error": "Couldn't create game"})
 			return
 		}
-		first = false
+		slot.first = false
 		// If the waiting request got cancelled, nobody may be receiving anymore; never block here.
 		select {
-		case matchState <- matchMsg{epoch: epoch, state: MyState{Id: otherId, GameState: *state, Role: Circle}}:
+		case slot.state <- matchMsg{epoch: epoch, state: MyState{Id: otherId, GameState: *state, Role: Circle, Options: options, Takeback: None}}:
 		default:
 		}
-		ctx.IndentedJSON(200, MyState{Id: myId, GameState: *state, Role: Cross})
+		ctx.IndentedJSON(200, MyState{Id: myId, GameState: *state, Role: Cross, Options: options, Takeback: None})
 		matchUpMutex.Unlock()
 		return
 	}
-	first = true
-	matchEpoch++
-	myEpoch := matchEpoch
+	slot.first = true
+	slot.epoch++
+	myEpoch := slot.epoch
 	matchUpMutex.Unlock()
 
 	for {
@@ -63,23 +105,23 @@ func play(ctx *gin.Context) {
 		case <-ctx.Request.Context().Done():
 			// Cleanup waiting slot if the client cancels while waiting for a match.
 			matchUpMutex.Lock()
-			if first && matchEpoch == myEpoch {
-				first = false
-				matchEpoch++
+			if slot.first && slot.epoch == myEpoch {
+				slot.first = false
+				slot.epoch++
 			}
 			matchUpMutex.Unlock()
 
 			// Drain any stale messages so they don't affect the next match.
 			for {
 				select {
-				case <-matchState:
+				case <-slot.state:
 				default:
 					ctx.JSON(408, gin.H{"error": "Match cancelled"})
 					return
 				}
 			}
 
-		case msg := <-matchState:
+		case msg := <-slot.state:
 			// Ignore stale messages from a previously cancelled waiting request.
 			if msg.epoch != myEpoch {
 				continue
@@ -93,6 +135,22 @@ func play(ctx *gin.Context) {
 		}
 	}
 }
+
+// claimBotGame is how the bot joins the games players start against it.
+func claimBotGame(ctx *gin.Context) {
+	secret := ctx.GetHeader("X-Bot-Secret")
+	if botSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(botSecret)) != 1 {
+		ctx.JSON(403, gin.H{"error": "Only the bot can claim seats"})
+		return
+	}
+	state, ok := ClaimBotSeat()
+	if !ok {
+		ctx.Status(204)
+		return
+	}
+	ctx.IndentedJSON(200, state)
+}
+
 func move(ctx *gin.Context) {
 	var moveData Move
 	if err := ctx.ShouldBindJSON(&moveData); err != nil {
@@ -108,6 +166,10 @@ func move(ctx *gin.Context) {
 		return
 	}
 	id := idParam.Id
+	if BotGameAbandoned(id) {
+		ctx.JSON(410, gin.H{"error": ErrBotAbsent.Error()})
+		return
+	}
 
 	state, err := MakeMove(dbPointer, id, moveData)
 	if err != nil {
@@ -127,6 +189,10 @@ func getState(ctx *gin.Context) {
 		return
 	}
 	id := idParam.Id
+	if BotGameAbandoned(id) {
+		ctx.JSON(410, gin.H{"error": ErrBotAbsent.Error()})
+		return
+	}
 
 	tx, err := dbPointer.Begin()
 	if err != nil {
@@ -140,9 +206,211 @@ func getState(ctx *gin.Context) {
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	info, err := GetGameInfo(tx, id)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+	ctx.IndentedJSON(200, MyState{Id: id, GameState: *state, Role: player, Options: info.Options, Takeback: info.Takeback})
+}
+
+func requestTakeback(ctx *gin.Context) {
+	var idParam struct {
+		Id int64 `form:"id" binding:"required"`
+	}
+	if err := ctx.ShouldBindQuery(&idParam); err != nil {
+		ctx.JSON(400, gin.H{"error": "Missing id parameter"})
+		return
+	}
+
+	if err := RequestTakeback(dbPointer, idParam.Id); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(204)
+}
+
+func getHint(ctx *gin.Context) {
+	var idParam struct {
+		Id int64 `form:"id" binding:"required"`
+	}
+	if err := ctx.ShouldBindQuery(&idParam); err != nil {
+		ctx.JSON(400, gin.H{"error": "Missing id parameter"})
+		return
+	}
+
+	hint, err := GetHint(ctx.Request.Context(), dbPointer, idParam.Id)
+	if err == ErrAnalysisUnavailable {
+		ctx.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(200, hint)
+}
+
+func answerTakeback(accept bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var idParam struct {
+			Id int64 `form:"id" binding:"required"`
+		}
+		if err := ctx.ShouldBindQuery(&idParam); err != nil {
+			ctx.JSON(400, gin.H{"error": "Missing id parameter"})
+			return
+		}
+
+		state, err := AnswerTakeback(dbPointer, idParam.Id, accept)
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.IndentedJSON(200, state)
+	}
+}
+
+func gameIdParam(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid id parameter"})
+		return 0, false
+	}
+	return id, true
+}
+
+func getRecord(ctx *gin.Context) {
+	id, ok := gameIdParam(ctx)
+	if !ok {
+		return
+	}
+
+	tx, err := dbPointer.Begin()
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	record, err := GetRecord(tx, id)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	tx.Commit()
-	ctx.IndentedJSON(200, MyState{Id: id, GameState: *state, Role: player})
+	ctx.String(200, record.String())
+}
+
+func getReplayState(ctx *gin.Context) {
+	id, ok := gameIdParam(ctx)
+	if !ok {
+		return
+	}
+	var plyParam struct {
+		Ply *int `form:"ply"`
+	}
+	if err := ctx.ShouldBindQuery(&plyParam); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid ply parameter"})
+		return
+	}
+
+	tx, err := dbPointer.Begin()
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	info, err := GetGameInfo(tx, id)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	moves, err := GetMoves(tx, info.GameId)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": "Database error"})
+		return
+	}
+	tx.Commit()
+
+	ply := len(moves)
+	if plyParam.Ply != nil {
+		ply = *plyParam.Ply
+	}
+	state, err := replays.StateAt(info.GameId, info.Options.Rules, moves, ply)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	result := ReplayState{GameState: state, Ply: ply, Plies: len(moves)}
+	if ply > 0 {
+		result.LastMove = &moves[ply-1]
+	}
+	ctx.IndentedJSON(200, result)
+}
+
+func analyze(ctx *gin.Context) {
+	var request GameAnalysisRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || (request.Id == 0 && request.State == nil) {
+		ctx.JSON(400, gin.H{"error": "Invalid analysis request"})
+		return
+	}
+
+	status, body, err := AnalyzeGame(ctx.Request.Context(), dbPointer, request)
+	if err == ErrAnalysisUnavailable {
+		ctx.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Data(status, "application/json", body)
+}
+
+func getNextPuzzle(ctx *gin.Context) {
+	var afterParam struct {
+		After int64 `form:"after"`
+	}
+	if err := ctx.ShouldBindQuery(&afterParam); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid after parameter"})
+		return
+	}
+
+	puzzle, err := NextPuzzle(dbPointer, afterParam.After)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(200, puzzle)
+}
+
+func attemptPuzzle(ctx *gin.Context) {
+	id, ok := gameIdParam(ctx)
+	if !ok {
+		return
+	}
+	var attempt struct {
+		Moves []Move `json:"moves"`
+	}
+	if err := ctx.ShouldBindJSON(&attempt); err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid attempt"})
+		return
+	}
+
+	result, err := AttemptPuzzle(ctx.Request.Context(), dbPointer, id, attempt.Moves)
+	if err == ErrAnalysisUnavailable || err == ErrNotSolved || err == ErrAnalysisBusy {
+		ctx.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(200, result)
 }
 
 func startDailyCleanup(ctx context.Context, db *sql.DB) {
@@ -163,6 +431,12 @@ func startDailyCleanup(ctx context.Context, db *sql.DB) {
 		defer ticker.Stop()
 
 		for {
+			// Mine the day's games before they go; games it can't get to are kept for the next run.
+			if games, puzzles, err := MinePuzzles(ctx, db); err != nil {
+				log.Printf("daily puzzle mining failed: %v", err)
+			} else {
+				log.Printf("daily puzzle mining: games=%d puzzles=%d", games, puzzles)
+			}
 			if err := ClearGames(db); err != nil {
 				log.Printf("daily cleanup failed: %v", err)
 			} else {
@@ -179,19 +453,32 @@ func startDailyCleanup(ctx context.Context, db *sql.DB) {
 }
 
 func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
 	db, err := SetUpDatabase()
 	dbPointer = db
 	if err != nil {
 		panic("Database creation failed")
 	}
+	if url := os.Getenv("ANALYSIS_URL"); url != "" {
+		analysisURL = url
+	}
+	botSecret = os.Getenv("BOT_SECRET")
+	if flag.NArg() > 0 {
+		err = runCommand(db, flag.Args())
+		CleanupDatabase(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	defer CleanupDatabase(db)
 
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	defer cleanupCancel()
 	startDailyCleanup(cleanupCtx, dbPointer)
 
-	log.SetFlags(0)
-	flag.Parse()
 	if envAddr := os.Getenv("ADDR"); envAddr != "" {
 		*addr = envAddr
 	}
@@ -200,5 +487,15 @@ func main() {
 	r.POST("/play", play)
 	r.PUT("/play", move)
 	r.GET("/play", getState)
+	r.POST("/play/bot", claimBotGame)
+	r.GET("/play/hint", getHint)
+	r.POST("/play/takeback", requestTakeback)
+	r.PUT("/play/takeback", answerTakeback(true))
+	r.DELETE("/play/takeback", answerTakeback(false))
+	r.GET("/games/:id/record", getRecord)
+	r.GET("/games/:id/state", getReplayState)
+	r.POST("/analyze", analyze)
+	r.GET("/puzzles/next", getNextPuzzle)
+	r.POST("/puzzles/:id/attempt", attemptPuzzle)
 	r.Run(*addr)
 }
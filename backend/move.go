@@ -1,44 +1,121 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"slices"
+)
 
+// Move places a mark. CellX/CellY pick the board on the outermost level and FinalX/FinalY the
+// cell on the bottom level; with three levels MidX/MidY pick the board in between.
 type Move struct {
 	Player Player `json:"player"`
 	CellX  int    `json:"cellX"`
 	CellY  int    `json:"cellY"`
+	MidX   int    `json:"midX,omitempty"`
+	MidY   int    `json:"midY,omitempty"`
 	FinalX int    `json:"finalX"`
 	FinalY int    `json:"finalY"`
 }
 
+// path lists the cell picked at every level, outermost first.
+func (this Move) path(rules Rules) [MaxDepth][2]int {
+	path := [MaxDepth][2]int{{this.CellX, this.CellY}}
+	if rules.Depth > 2 {
+		path[1] = [2]int{this.MidX, this.MidY}
+	}
+	path[rules.Depth-1] = [2]int{this.FinalX, this.FinalY}
+	return path
+}
+
+// Board returns the Location-style index of the bottom-level board the move is played on.
+func (this Move) Board(rules Rules) int {
+	path := this.path(rules)
+	index := 0
+	for level := range rules.Depth - 1 {
+		index = index*rules.Size*rules.Size + path[level][0]*rules.Size + path[level][1]
+	}
+	return index
+}
+
+// MoveAt builds the move placing player's mark on cell (x, y) of the bottom-level board with the given index.
+func MoveAt(rules Rules, player Player, board int, x int, y int) Move {
+	path := rules.boardPath(board)
+	path[rules.Depth-1] = [2]int{x, y}
+	move := Move{Player: player, CellX: path[0][0], CellY: path[0][1], FinalX: x, FinalY: y}
+	if rules.Depth > 2 {
+		move.MidX, move.MidY = path[1][0], path[1][1]
+	}
+	return move
+}
+
+// copyRow returns grid with row x copied, so cells in that row can change without affecting the
+// states grid is shared with.
+func copyRow[T any](grid [][]T, x int) [][]T {
+	grid = slices.Clone(grid)
+	grid[x] = slices.Clone(grid[x])
+	return grid
+}
+
 func PerformMove(current State, move Move) (State, error) {
+	rules := current.Rules
 	if move.Player == None {
 		return current, errors.New("Player cannot be none")
 	}
 	if move.Player != current.ToMove {
 		return current, errors.New("Not your turn")
 	}
-	if move.CellX < 0 || move.CellX >= 3 || move.CellY < 0 || move.CellY >= 3 {
+	if !rules.inRange(move.CellX, move.CellY) {
+		return current, errors.New("Invalid cell coordinates")
+	}
+	// Without a middle level MidX/MidY must be left out, so a move has a single form.
+	if (rules.Depth > 2 && !rules.inRange(move.MidX, move.MidY)) || (rules.Depth == 2 && (move.MidX != 0 || move.MidY != 0)) {
 		return current, errors.New("Invalid cell coordinates")
 	}
-	if move.FinalX < 0 || move.FinalX >= 3 || move.FinalY < 0 || move.FinalY >= 3 {
+	if !rules.inRange(move.FinalX, move.FinalY) {
 		return current, errors.New("Invalid final coordinates")
 	}
-	if current.Location != -1 && (move.CellX != current.Location/3 || move.CellY != current.Location%3) {
+	board := move.Board(rules)
+	// Being sent to a board that can't be played on lets the player play anywhere; PerformMove never
+	// leaves Location on such a board, but states from elsewhere may.
+	if current.Location != -1 && current.Playable(current.Location) && board != current.Location {
 		return current, errors.New("Illegal move")
 	}
-	if current.Get(move.CellX, move.CellY) != None {
+	local, open := current.Board(board)
+	if !open {
 		return current, errors.New("Illegal move")
 	}
-	if current.Values[move.CellX][move.CellY].Get(move.FinalX, move.FinalY) != None {
+	if local.Get(move.FinalX, move.FinalY) != None {
 		return current, errors.New("Illegal move")
 	}
 	if current.Winner != None {
 		return current, errors.New("Game already finished")
 	}
 
-	// Place the move
-	current.Values[move.CellX][move.CellY].Values[move.FinalX][move.FinalY] = move.Player
-	current.Values[move.CellX][move.CellY].Update()
+	// Place the move, copying the boards on its path so the previous state stays intact.
+	path := move.path(rules)
+	var boards [MaxDepth]*LocalState
+	current.Values = copyRow(current.Values, path[0][0])
+	boards[0] = &current.Values[path[0][0]][path[0][1]]
+	for level := 1; level < rules.Depth-1; level++ {
+		parent := boards[level-1]
+		parent.Values = copyRow(parent.Values, path[level][0])
+		parent.Boards = copyRow(parent.Boards, path[level][0])
+		boards[level] = &parent.Boards[path[level][0]][path[level][1]]
+	}
+	bottom := boards[rules.Depth-2]
+	bottom.Values = copyRow(bottom.Values, move.FinalX)
+	bottom.Values[move.FinalX][move.FinalY] = move.Player
+
+	// A won board counts as a mark on the board containing it. Boards keep their first winner
+	// when they stay in play after being won.
+	for level := rules.Depth - 2; level >= 0; level-- {
+		if boards[level].Winner == None {
+			boards[level].Update(rules.Line)
+		}
+		if level > 0 {
+			boards[level-1].Values[path[level][0]][path[level][1]] = boards[level].Winner
+		}
+	}
 
 	// Switch turn
 	if current.ToMove == Cross {
@@ -47,8 +124,11 @@ func PerformMove(current State, move Move) (State, error) {
 		current.ToMove = Cross
 	}
 
-	current.Location = move.FinalX*3 + move.FinalY
-	if current.Get(move.FinalX, move.FinalY) != None {
+	// The cells picked below the outermost level name the board the opponent is sent to.
+	// If that board is finished (won) or has no empty cells, the next player may play anywhere.
+	cells := rules.Size * rules.Size
+	current.Location = board%(rules.BoardCount()/cells)*cells + move.FinalX*rules.Size + move.FinalY
+	if !current.Playable(current.Location) {
 		current.Location = -1
 	}
 	current.Update()
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestPerformMoveMiddleCoordinates(t *testing.T) {
+	threeLevels := Rules{Size: 3, Line: 3, Depth: 3, Variant: VariantStandard}
+	tests := []struct {
+		name  string
+		rules Rules
+		move  Move
+		legal bool
+	}{
+		{"two levels", ClassicRules, Move{Player: Cross, CellX: 1, CellY: 1, FinalX: 1, FinalY: 1}, true},
+		{"two levels with a middle board", ClassicRules, Move{Player: Cross, CellX: 1, CellY: 1, MidX: 1, FinalX: 1, FinalY: 1}, false},
+		{"three levels", threeLevels, Move{Player: Cross, CellX: 1, CellY: 1, MidX: 2, MidY: 0, FinalX: 1, FinalY: 1}, true},
+		{"three levels off the board", threeLevels, Move{Player: Cross, CellX: 1, CellY: 1, MidX: 3, FinalX: 1, FinalY: 1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := PerformMove(NewState(test.rules), test.move)
+			if (err == nil) != test.legal {
+				t.Fatalf("PerformMove(%+v) error %v, want legal=%v", test.move, err, test.legal)
+			}
+		})
+	}
+}
+
+func TestStrayMiddleCoordinatesCleared(t *testing.T) {
+	db := testDatabase(t)
+	_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, moves := randomGame(t, ClassicRules, 7, 2)
+	playMoves(t, db, crossId, circleId, moves)
+	if _, err := db.Exec(`UPDATE moves SET mid_x = 1 WHERE game_id = ?`, crossId); err != nil {
+		t.Fatal(err)
+	}
+	// Setting the database up again clears them.
+	db, err = SetUpDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CleanupDatabase(db)
+	transaction, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transaction.Rollback()
+	logged, err := GetMoves(transaction, crossId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReplayMoves(ClassicRules, logged); err != nil {
+		t.Fatal(err)
+	}
+}
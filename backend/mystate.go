@@ -1,7 +1,10 @@
 package main
 
 type MyState struct {
-	GameState State  `json:"game_state"`
-	Role      Player `json:"role"`
-	Id        int64  `json:"id"`
+	GameState State       `json:"game_state"`
+	Role      Player      `json:"role"`
+	Id        int64       `json:"id"`
+	Options   GameOptions `json:"options"`
+	// Takeback is the player waiting for the opponent to accept a takeback, or None.
+	Takeback Player `json:"takeback"`
 }
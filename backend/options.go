@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BotLevels are the bot's difficulty levels, weakest first; they must match the bot's.
+var BotLevels = []string{"beginner", "easy", "medium", "hard", "max"}
+
+// GameOptions are picked by a player when looking for a match (as query parameters of POST /play)
+// and stored with the game.
+type GameOptions struct {
+	// Rated games count for the players' standing, so takebacks are disabled.
+	Rated bool `form:"rated" json:"rated"`
+	// BotLevel asks for a game against the bot at that level instead of waiting for an opponent.
+	BotLevel string `form:"bot_level" json:"bot_level,omitempty"`
+	// Rules pick the board geometry; parameters left out mean classic ultimate tic-tac-toe.
+	Rules
+}
+
+func (this GameOptions) Validate() error {
+	if this.BotLevel != "" && !slices.Contains(BotLevels, this.BotLevel) {
+		return fmt.Errorf("Unknown bot level %q", this.BotLevel)
+	}
+	return this.Rules.Validate()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// A puzzle is the earliest position of a finished game from which the side to move has a
+	// forced win of minPuzzlePlies to maxPuzzlePlies plies, as the solver finds in minePuzzleTimeMs.
+	minPuzzlePlies   = 3
+	maxPuzzlePlies   = 11
+	minePuzzleTimeMs = 1000
+	// attemptTimeMs is the solver's time for each position of an attempt, which is near the end,
+	// and maxAttemptSolves the positions it solves at most in an attempt.
+	attemptTimeMs    = 1000
+	maxAttemptSolves = 3
+	// analysisBusyRetries is how many times mining asks again while the analysis service is busy.
+	analysisBusyRetries = 10
+)
+
+// analysisBusyWait is how long mining waits for the analysis service to be free.
+var analysisBusyWait = 1 * time.Second
+
+// Puzzle is a position where the side to move wins by force in Plies plies; the solution is kept
+// from the player until they attempt it.
+type Puzzle struct {
+	Id    int64 `json:"id"`
+	State State `json:"state"`
+	Plies int   `json:"plies"`
+}
+
+type PuzzleAttempt struct {
+	Correct bool `json:"correct"`
+	// Reason says what is wrong with an incorrect line.
+	Reason   string `json:"reason,omitempty"`
+	Solution []Move `json:"solution"`
+}
+
+// MinePuzzles looks for puzzles in the finished games it hasn't mined yet, and returns the number
+// of games mined and of puzzles found. It needs the analysis service to solve positions.
+func MinePuzzles(ctx context.Context, db *sql.DB) (int, int, error) {
+	rows, err := db.Query(`SELECT cross_id, state FROM games WHERE puzzles_mined = 0`)
+	if err != nil {
+		return 0, 0, err
+	}
+	type game struct {
+		id    int64
+		state State
+	}
+	var games []game
+	for rows.Next() {
+		var g game
+		var stateString string
+		if err := rows.Scan(&g.id, &stateString); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		if json.Unmarshal([]byte(stateString), &g.state) == nil && g.state.IsOver() {
+			games = append(games, g)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	found := 0
+	for _, g := range games {
+		puzzle, ok, err := minePuzzle(ctx, db, g.id, g.state.Rules)
+		if err != nil {
+			return len(games), found, err
+		}
+		transaction, err := db.Begin()
+		if err != nil {
+			return len(games), found, err
+		}
+		if ok {
+			_, err = transaction.Exec(`INSERT OR IGNORE INTO puzzles(game_id, ply, state, solution, plies) VALUES (?, ?, ?, ?, ?)`,
+				g.id, puzzle.ply, puzzle.state, puzzle.solution, puzzle.plies)
+			if err != nil {
+				transaction.Rollback()
+				return len(games), found, err
+			}
+			found++
+		}
+		_, err = transaction.Exec(`UPDATE games SET puzzles_mined = 1 WHERE cross_id = ?`, g.id)
+		if err != nil {
+			transaction.Rollback()
+			return len(games), found, err
+		}
+		if err := transaction.Commit(); err != nil {
+			return len(games), found, err
+		}
+	}
+	return len(games), found, nil
+}
+
+type minedPuzzle struct {
+	ply      int
+	state    string
+	solution string
+	plies    int
+}
+
+// minePuzzle solves the positions of a game from the end backwards for as long as the side to
+// move wins or loses by force within maxPuzzlePlies, and keeps the earliest win.
+func minePuzzle(ctx context.Context, db *sql.DB, gameId int64, rules Rules) (minedPuzzle, bool, error) {
+	if rules != ClassicRules {
+		// Only classic games can be solved.
+		return minedPuzzle{}, false, nil
+	}
+	transaction, err := db.Begin()
+	if err != nil {
+		return minedPuzzle{}, false, err
+	}
+	moves, err := GetMoves(transaction, gameId)
+	transaction.Rollback()
+	if err != nil {
+		return minedPuzzle{}, false, err
+	}
+	states := []State{NewState(rules)}
+	for _, move := range moves {
+		next, err := PerformMove(states[len(states)-1], move)
+		if err != nil {
+			return minedPuzzle{}, false, nil
+		}
+		states = append(states, next)
+	}
+
+	var best *Solution
+	bestPly := 0
+	for ply := len(moves) - 1; ply >= 0; ply-- {
+		solution, err := solveWhenFree(ctx, &states[ply], minePuzzleTimeMs)
+		if err == ErrNotSolved {
+			break
+		}
+		if err != nil {
+			return minedPuzzle{}, false, err
+		}
+		if solution.Outcome == OutcomeWin && solution.Distance <= maxPuzzlePlies {
+			best, bestPly = solution, ply
+		} else if solution.Outcome != OutcomeLoss || solution.Distance > maxPuzzlePlies {
+			break
+		}
+	}
+	if best == nil || best.Distance < minPuzzlePlies {
+		return minedPuzzle{}, false, nil
+	}
+	stateString, err := json.Marshal(states[bestPly])
+	if err != nil {
+		return minedPuzzle{}, false, err
+	}
+	solutionString, err := json.Marshal(best.Line)
+	if err != nil {
+		return minedPuzzle{}, false, err
+	}
+	return minedPuzzle{ply: bestPly, state: string(stateString), solution: string(solutionString), plies: best.Distance}, true, nil
+}
+
+// solveWhenFree is RequestSolution, asking again while the analysis service is busy. It gives up
+// with ErrAnalysisBusy after analysisBusyRetries tries.
+func solveWhenFree(ctx context.Context, state *State, timeMs int) (*Solution, error) {
+	for try := 1; ; try++ {
+		solution, err := RequestSolution(ctx, state, timeMs)
+		if err != ErrAnalysisBusy || try == analysisBusyRetries {
+			return solution, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(analysisBusyWait):
+		}
+	}
+}
+
+// NextPuzzle returns the first puzzle after the one with id after (0 for the first one).
+func NextPuzzle(db *sql.DB, after int64) (*Puzzle, error) {
+	var puzzle Puzzle
+	var stateString string
+	err := db.QueryRow(`SELECT id, state, plies FROM puzzles WHERE id > ? ORDER BY id LIMIT 1`, after).
+		Scan(&puzzle.Id, &stateString, &puzzle.Plies)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("No more puzzles")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(stateString), &puzzle.State); err != nil {
+		return nil, err
+	}
+	return &puzzle, nil
+}
+
+// AttemptPuzzle checks a line of moves, the player's and the replies they expect, from a puzzle's
+// position: it is correct if each of the player's moves keeps a forced win, as the solver finds,
+// and the line ends with the player winning. Any winning move is accepted, not only the stored
+// solution's, but the solver is only asked about moves off the lines it already found, at most
+// maxAttemptSolves times.
+func AttemptPuzzle(ctx context.Context, db *sql.DB, id int64, moves []Move) (*PuzzleAttempt, error) {
+	var stateString, solutionString string
+	err := db.QueryRow(`SELECT state, solution FROM puzzles WHERE id = ?`, id).Scan(&stateString, &solutionString)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("Not a valid puzzle")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal([]byte(stateString), &state); err != nil {
+		return nil, err
+	}
+	attempt := &PuzzleAttempt{}
+	if err := json.Unmarshal([]byte(solutionString), &attempt.Solution); err != nil {
+		return nil, err
+	}
+	if len(moves) == 0 || len(moves) > maxPuzzlePlies*2 {
+		return nil, errors.New("Invalid number of moves")
+	}
+
+	player := state.ToMove
+	// known is a winning line from state: the player's moves along it keep the win.
+	known := attempt.Solution
+	solves := 0
+	for i, move := range moves {
+		move.Player = state.ToMove
+		next, err := PerformMove(state, move)
+		if err != nil {
+			attempt.Reason = fmt.Sprintf("Move %d is illegal: %v", i+1, err)
+			return attempt, nil
+		}
+		following := len(known) > 0 && known[0] == move
+		if following {
+			known = known[1:]
+		} else {
+			known = nil
+		}
+		if state.ToMove == player && !following && !next.IsOver() {
+			if solves == maxAttemptSolves {
+				return nil, errors.New("The line strays too far from the known solutions to check")
+			}
+			solves++
+			solution, err := RequestSolution(ctx, &next, attemptTimeMs)
+			if err != nil {
+				return nil, err
+			}
+			if solution.Outcome != OutcomeLoss {
+				attempt.Reason = fmt.Sprintf("Move %d lets the win slip", i+1)
+				return attempt, nil
+			}
+			known = solution.Line
+		}
+		state = next
+		if state.IsOver() && i < len(moves)-1 {
+			attempt.Reason = fmt.Sprintf("The game is over after move %d", i+1)
+			return attempt, nil
+		}
+	}
+	if state.Winner != player {
+		attempt.Reason = "The line does not win the game yet"
+		return attempt, nil
+	}
+	attempt.Correct = true
+	return attempt, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSolver solves the positions of one finished game as if its winner had forced the win from
+// the start, and the positions off the game as unknown says.
+type fakeSolver struct {
+	states  []State // after each ply of the game
+	moves   []Move
+	unknown Solution
+	calls   int
+	busy    int // calls answered with busy before solving
+}
+
+func (this *fakeSolver) handle(w http.ResponseWriter, r *http.Request) {
+	var request AnalysisRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	this.calls++
+	if this.busy > 0 {
+		this.busy--
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"Analysis is busy, try again later"}`))
+		return
+	}
+	solution := this.unknown
+	for ply, state := range this.states {
+		if reflect.DeepEqual(state, *request.State) {
+			winner := this.states[len(this.states)-1].Winner
+			solution = Solution{Outcome: OutcomeLoss, Distance: len(this.moves) - ply, Line: this.moves[ply:]}
+			if state.ToMove == winner {
+				solution.Outcome = OutcomeWin
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(solution)
+}
+
+// wonGame plays random games until one is won after enough moves for a puzzle, and stores it.
+func wonGame(t *testing.T, db *sql.DB) *fakeSolver {
+	t.Helper()
+	for seed := uint64(1); ; seed++ {
+		state, moves := randomGame(t, ClassicRules, seed, 81)
+		if state.Winner == None || len(moves) < 2*maxPuzzlePlies {
+			continue
+		}
+		solver := &fakeSolver{unknown: Solution{Outcome: OutcomeWin, Distance: 1}}
+		for ply := range len(moves) + 1 {
+			state, _ := ReplayMoves(ClassicRules, moves[:ply])
+			solver.states = append(solver.states, state)
+		}
+		solver.moves = moves
+		_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		playMoves(t, db, crossId, circleId, moves)
+		fakeAnalysisService(t, solver.handle)
+		return solver
+	}
+}
+
+func puzzlesMined(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var mined int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM games WHERE puzzles_mined = 1`).Scan(&mined); err != nil {
+		t.Fatal(err)
+	}
+	return mined
+}
+
+func TestMinePuzzles(t *testing.T) {
+	db := testDatabase(t)
+	solver := wonGame(t, db)
+	games, puzzles, err := MinePuzzles(context.Background(), db)
+	if err != nil || games != 1 || puzzles != 1 {
+		t.Fatalf("mined %d games for %d puzzles (%v), want 1 and 1", games, puzzles, err)
+	}
+
+	// The earliest forced win within maxPuzzlePlies is maxPuzzlePlies from the end.
+	ply := len(solver.moves) - maxPuzzlePlies
+	puzzle, err := NextPuzzle(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puzzle.Plies != maxPuzzlePlies || !reflect.DeepEqual(puzzle.State, solver.states[ply]) {
+		t.Fatalf("puzzle of %d plies, want the position at ply %d", puzzle.Plies, ply)
+	}
+	if games, _, _ := MinePuzzles(context.Background(), db); games != 0 {
+		t.Fatalf("mined %d games again", games)
+	}
+}
+
+func TestMinePuzzlesBusy(t *testing.T) {
+	saved := analysisBusyWait
+	analysisBusyWait = time.Millisecond
+	t.Cleanup(func() { analysisBusyWait = saved })
+
+	db := testDatabase(t)
+	solver := wonGame(t, db)
+	solver.busy = 1 << 30
+	if _, _, err := MinePuzzles(context.Background(), db); err != ErrAnalysisBusy {
+		t.Fatalf("error %v, want %v", err, ErrAnalysisBusy)
+	}
+	if solver.calls != analysisBusyRetries {
+		t.Fatalf("asked %d times, want %d", solver.calls, analysisBusyRetries)
+	}
+	if mined := puzzlesMined(t, db); mined != 0 {
+		t.Fatal("marked a game mined while the solver was busy")
+	}
+
+	// Mining waits for the solver.
+	solver.busy = analysisBusyRetries - 1
+	if _, puzzles, err := MinePuzzles(context.Background(), db); err != nil || puzzles != 1 {
+		t.Fatalf("found %d puzzles (%v) once the solver was free, want 1", puzzles, err)
+	}
+	if mined := puzzlesMined(t, db); mined != 1 {
+		t.Fatal("the game isn't marked mined")
+	}
+}
+
+func TestAttemptPuzzle(t *testing.T) {
+	db := testDatabase(t)
+	solver := wonGame(t, db)
+	if _, _, err := MinePuzzles(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	puzzle, err := NextPuzzle(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := solver.moves[len(solver.moves)-maxPuzzlePlies:]
+
+	// offLine plays plies moves off the solution from the puzzle that don't end the game.
+	offLine := func(plies int) []Move {
+		state := puzzle.State
+		var moves []Move
+		for range plies {
+			for _, move := range legalMoves(state) {
+				next, _ := PerformMove(state, move)
+				if next.IsOver() || (len(moves) == 0 && move == solution[0]) {
+					continue
+				}
+				state, moves = next, append(moves, move)
+				break
+			}
+		}
+		return moves
+	}
+	// The player follows the solution, but the opponent answers differently, so the player's next
+	// move is off the known lines.
+	otherReply := []Move{solution[0]}
+	state := solver.states[len(solver.moves)-maxPuzzlePlies+1]
+	for _, move := range legalMoves(state) {
+		next, _ := PerformMove(state, move)
+		if move != solution[1] && !next.IsOver() {
+			otherReply, state = append(otherReply, move), next
+			break
+		}
+	}
+	otherReply = append(otherReply, legalMoves(state)[0])
+
+	tests := []struct {
+		name    string
+		moves   []Move
+		unknown string // the outcome of positions off the game for the side to move
+		reason  string // why the attempt is incorrect, empty if it is correct
+		calls   int
+		fails   bool
+	}{
+		{"solution", solution, OutcomeWin, "", 0, false},
+		{"solution cut short", solution[:5], OutcomeWin, "The line does not win the game yet", 0, false},
+		{"win slips", offLine(1), OutcomeWin, "Move 1 lets the win slip", 1, false},
+		{"other win", offLine(1), OutcomeLoss, "The line does not win the game yet", 1, false},
+		{"opponent's other reply", otherReply, OutcomeLoss, "The line does not win the game yet", 1, false},
+		{"too far off", offLine(2*maxAttemptSolves + 1), OutcomeLoss, "", maxAttemptSolves, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			solver.calls, solver.unknown = 0, Solution{Outcome: test.unknown, Distance: 5}
+			attempt, err := AttemptPuzzle(context.Background(), db, puzzle.Id, test.moves)
+			if (err != nil) != test.fails {
+				t.Fatalf("error %v", err)
+			}
+			if err == nil && (attempt.Correct != (test.reason == "") || attempt.Reason != test.reason) {
+				t.Fatalf("attempt %+v, want reason %q", attempt, test.reason)
+			}
+			if solver.calls != test.calls {
+				t.Fatalf("asked the solver %d times, want %d", solver.calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestClearGamesKeepsUnmined(t *testing.T) {
+	db := testDatabase(t)
+	wonGame(t, db)
+	if _, _, _, err := CreateGame(db, GameOptions{Rules: ClassicRules}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearGames(db); err != nil {
+		t.Fatal(err)
+	}
+	if games := countGames(t, db); games != 1 {
+		t.Fatalf("%d games left, want the won game not mined yet", games)
+	}
+
+	// Once mined, the game and its moves go too.
+	if _, puzzles, err := MinePuzzles(context.Background(), db); err != nil || puzzles != 1 {
+		t.Fatalf("found %d puzzles (%v) after clearing, want 1", puzzles, err)
+	}
+	if err := ClearGames(db); err != nil {
+		t.Fatal(err)
+	}
+	var moves int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM moves`).Scan(&moves); err != nil {
+		t.Fatal(err)
+	}
+	if games := countGames(t, db); games != 0 || moves != 0 {
+		t.Fatalf("%d games and %d moves left", games, moves)
+	}
+	if _, err := NextPuzzle(db, 0); err != nil {
+		t.Fatalf("the puzzle went with its game: %v", err)
+	}
+}
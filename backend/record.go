@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ResultCrossWins  = "1-0"
+	ResultCircleWins = "0-1"
+	ResultDraw       = "1/2-1/2"
+	ResultOngoing    = "*"
+
+	recordDateLayout = "2006.01.02"
+	unknownDate      = "????.??.??"
+	unknownPlayer    = "?"
+	noTimeControl    = "-"
+)
+
+// GameRecord is the portable text form of a game: PGN-style headers followed by numbered moves.
+//
+// Moves are written as squares of the grid of all bottom-level cells (9x9 in classic games):
+// the file (a, b, ... z, aa, ab, ...) is the column, e.g. CellY*3+FinalY, and the rank
+// (1, 2, ...) is the row, e.g. CellX*3+FinalX, counted from the top.
+type GameRecord struct {
+	Rules       Rules
+	Cross       string
+	Circle      string
+	Result      string
+	Date        time.Time
+	TimeControl string
+	// Hints counts the hints each player took, indexed by Player.
+	Hints [2]int
+	Moves []Move
+}
+
+// gridSide is the number of bottom-level cells along one side of the whole game.
+func gridSide(rules Rules) int {
+	side := 1
+	for range rules.Depth {
+		side *= rules.Size
+	}
+	return side
+}
+
+func MoveNotation(rules Rules, move Move) string {
+	path := move.path(rules)
+	row, column := 0, 0
+	for level := range rules.Depth {
+		row = row*rules.Size + path[level][0]
+		column = column*rules.Size + path[level][1]
+	}
+	file := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		file = string(rune('a'+(column-1)%26)) + file
+	}
+	return fmt.Sprintf("%s%d", file, row+1)
+}
+
+func ParseMoveNotation(rules Rules, text string, player Player) (Move, error) {
+	letters := strings.TrimRight(text, "0123456789")
+	row, err := strconv.Atoi(text[len(letters):])
+	if letters == "" || err != nil {
+		return Move{}, fmt.Errorf("Invalid move %q", text)
+	}
+	column := 0
+	for _, letter := range letters {
+		if letter < 'a' || letter > 'z' {
+			return Move{}, fmt.Errorf("Invalid move %q", text)
+		}
+		column = column*26 + int(letter-'a') + 1
+	}
+	row--
+	column--
+	side := gridSide(rules)
+	if row < 0 || row >= side || column < 0 || column >= side {
+		return Move{}, fmt.Errorf("Invalid move %q", text)
+	}
+	var path [MaxDepth][2]int
+	for level := rules.Depth - 1; level >= 0; level-- {
+		path[level] = [2]int{row % rules.Size, column % rules.Size}
+		row /= rules.Size
+		column /= rules.Size
+	}
+	move := Move{Player: player, CellX: path[0][0], CellY: path[0][1]}
+	if rules.Depth > 2 {
+		move.MidX, move.MidY = path[1][0], path[1][1]
+	}
+	move.FinalX, move.FinalY = path[rules.Depth-1][0], path[rules.Depth-1][1]
+	return move, nil
+}
+
+// formatRules writes a non-classic geometry for the Rules header, e.g. "size=4 line=3 depth=2".
+// The variant has a header of its own.
+func formatRules(rules Rules) string {
+	return fmt.Sprintf("size=%d line=%d depth=%d", rules.Size, rules.Line, rules.Depth)
+}
+
+func parseRules(text string, rules *Rules) error {
+	_, err := fmt.Sscanf(text, "size=%d line=%d depth=%d", &rules.Size, &rules.Line, &rules.Depth)
+	if err != nil {
+		return fmt.Errorf("Invalid rules %q", text)
+	}
+	return nil
+}
+
+// ResultOf reports the record result of a state; a game nobody can continue is a draw.
+func ResultOf(state State) string {
+	switch state.Winner {
+	case Cross:
+		return ResultCrossWins
+	case Circle:
+		return ResultCircleWins
+	}
+	if !state.IsOver() {
+		return ResultOngoing
+	}
+	return ResultDraw
+}
+
+func (record *GameRecord) String() string {
+	var b strings.Builder
+	date := unknownDate
+	if !record.Date.IsZero() {
+		date = record.Date.UTC().Format(recordDateLayout)
+	}
+	writeHeader := func(key string, value string) {
+		fmt.Fprintf(&b, "[%s %q]\n", key, value)
+	}
+	writeHeader("Event", "Ultimate tic-tac-toe")
+	writeHeader("Date", date)
+	writeHeader("Cross", orDefault(record.Cross, unknownPlayer))
+	writeHeader("Circle", orDefault(record.Circle, unknownPlayer))
+	writeHeader("Result", orDefault(record.Result, ResultOngoing))
+	writeHeader("TimeControl", orDefault(record.TimeControl, noTimeControl))
+	rules := record.Rules.WithDefaults()
+	if rules.Size != ClassicRules.Size || rules.Line != ClassicRules.Line || rules.Depth != ClassicRules.Depth {
+		writeHeader("Rules", formatRules(rules))
+	}
+	if rules.Variant != ClassicRules.Variant {
+		writeHeader("Variant", rules.Variant)
+	}
+	if record.Hints[Cross] > 0 {
+		writeHeader("CrossHints", strconv.Itoa(record.Hints[Cross]))
+	}
+	if record.Hints[Circle] > 0 {
+		writeHeader("CircleHints", strconv.Itoa(record.Hints[Circle]))
+	}
+	b.WriteString("\n")
+
+	line := 0
+	writeToken := func(token string) {
+		if line > 0 && line+1+len(token) > 80 {
+			b.WriteString("\n")
+			line = 0
+		}
+		if line > 0 {
+			b.WriteString(" ")
+			line++
+		}
+		b.WriteString(token)
+		line += len(token)
+	}
+	for i, move := range record.Moves {
+		if i%2 == 0 {
+			writeToken(fmt.Sprintf("%d.", i/2+1))
+		}
+		writeToken(MoveNotation(rules, move))
+	}
+	writeToken(orDefault(record.Result, ResultOngoing))
+	b.WriteString("\n")
+	return b.String()
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// ParseRecord reads a record written by GameRecord.String. Moves are only checked for syntax;
+// use Replay to validate them against the rules.
+func ParseRecord(r io.Reader) (*GameRecord, error) {
+	record := &GameRecord{Rules: ClassicRules, Result: ResultOngoing, TimeControl: noTimeControl}
+	scanner := bufio.NewScanner(r)
+	var tokens []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			key, value, err := parseHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "Cross":
+				record.Cross = value
+			case "Circle":
+				record.Circle = value
+			case "Result":
+				record.Result = value
+			case "TimeControl":
+				record.TimeControl = value
+			case "Rules":
+				err = parseRules(value, &record.Rules)
+				if err != nil {
+					return nil, err
+				}
+			case "Variant":
+				record.Rules.Variant = value
+			case "CrossHints", "CircleHints":
+				player := Cross
+				if key == "CircleHints" {
+					player = Circle
+				}
+				record.Hints[player], err = strconv.Atoi(value)
+				if err != nil || record.Hints[player] < 0 {
+					return nil, fmt.Errorf("Invalid hint count %q", value)
+				}
+			case "Date":
+				if value != unknownDate {
+					record.Date, err = time.Parse(recordDateLayout, value)
+					if err != nil {
+						return nil, fmt.Errorf("Invalid date %q", value)
+					}
+				}
+			}
+			continue
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := record.Rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	for i, token := range tokens {
+		switch token {
+		case ResultCrossWins, ResultCircleWins, ResultDraw, ResultOngoing:
+			if token != record.Result {
+				return nil, fmt.Errorf("Result %q does not match header %q", token, record.Result)
+			}
+			if i+1 < len(tokens) {
+				return nil, fmt.Errorf("Unexpected %q after the result", tokens[i+1])
+			}
+			return record, nil
+		}
+		if strings.HasSuffix(token, ".") {
+			if _, err := strconv.Atoi(strings.TrimRight(token, ".")); err != nil {
+				return nil, fmt.Errorf("Invalid move number %q", token)
+			}
+			continue
+		}
+		player := Player(Cross)
+		if len(record.Moves)%2 == 1 {
+			player = Circle
+		}
+		move, err := ParseMoveNotation(record.Rules, token, player)
+		if err != nil {
+			return nil, err
+		}
+		record.Moves = append(record.Moves, move)
+	}
+	return record, nil
+}
+
+func parseHeader(line string) (string, string, error) {
+	if !strings.HasSuffix(line, "]") {
+		return "", "", fmt.Errorf("Invalid header %q", line)
+	}
+	key, quoted, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), " ")
+	if !ok {
+		return "", "", fmt.Errorf("Invalid header %q", line)
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(quoted))
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid header %q", line)
+	}
+	return key, value, nil
+}
+
+// ReplayMoves plays moves from the initial position, rejecting the first illegal one.
+func ReplayMoves(rules Rules, moves []Move) (State, error) {
+	state := NewState(rules)
+	for i, move := range moves {
+		next, err := PerformMove(state, move)
+		if err != nil {
+			return state, fmt.Errorf("Move %d (%s): %v", i+1, MoveNotation(rules, move), err)
+		}
+		state = next
+	}
+	return state, nil
+}
+
+// Replay validates the recorded moves and result, returning the final position.
+func (record *GameRecord) Replay() (State, error) {
+	state, err := ReplayMoves(record.Rules.WithDefaults(), record.Moves)
+	if err != nil {
+		return state, err
+	}
+	if record.Result != ResultOngoing && record.Result != ResultOf(state) {
+		return state, errors.New("Result does not match the moves")
+	}
+	return state, nil
+}
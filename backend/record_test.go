@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDatabase sets up an empty database in a temporary directory.
+func testDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db, err := SetUpDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CleanupDatabase(db) })
+	return db
+}
+
+// legalMoves lists the moves PerformMove accepts in state.
+func legalMoves(state State) []Move {
+	rules := state.Rules
+	var moves []Move
+	for board := range rules.BoardCount() {
+		for x := range rules.Size {
+			for y := range rules.Size {
+				move := MoveAt(rules, state.ToMove, board, x, y)
+				if _, err := PerformMove(state, move); err == nil {
+					moves = append(moves, move)
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// randomGame plays up to plies random moves from the start, fewer if the game ends.
+func randomGame(t *testing.T, rules Rules, seed uint64, plies int) (State, []Move) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(seed, seed))
+	state := NewState(rules)
+	var played []Move
+	for range plies {
+		moves := legalMoves(state)
+		if len(moves) == 0 {
+			break
+		}
+		move := moves[rng.IntN(len(moves))]
+		next, err := PerformMove(state, move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, played = next, append(played, move)
+	}
+	return state, played
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		plies int
+	}{
+		{"classic finished", ClassicRules, 81},
+		{"classic ongoing", ClassicRules, 10},
+		{"size 4 majority", Rules{Size: 4, Line: 3, Depth: 2, Variant: VariantMajority}, 256},
+		{"three levels", Rules{Size: 3, Line: 3, Depth: 3, Variant: VariantMisere}, 60},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, moves := randomGame(t, test.rules, uint64(i), test.plies)
+			record := &GameRecord{
+				Rules:       test.rules,
+				Cross:       "Alice",
+				Circle:      unknownPlayer,
+				Result:      ResultOf(state),
+				Date:        time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+				TimeControl: noTimeControl,
+				Hints:       [2]int{2, 0},
+				Moves:       moves,
+			}
+			parsed, err := ParseRecord(strings.NewReader(record.String()))
+			if err != nil {
+				t.Fatalf("ParseRecord: %v\n%s", err, record)
+			}
+			if !reflect.DeepEqual(parsed, record) {
+				t.Fatalf("parsed %+v, want %+v", parsed, record)
+			}
+			replayed, err := parsed.Replay()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(replayed, state) {
+				t.Fatalf("replayed state differs from the played one")
+			}
+		})
+	}
+}
+
+func TestParseRecordErrors(t *testing.T) {
+	headers := "[Result \"*\"]\n\n"
+	tests := []struct {
+		name   string
+		record string
+	}{
+		{"trailing token", headers + "1. e5 e4 * e6"},
+		{"trailing result", headers + "1. e5 e4 * *"},
+		{"result mismatch", headers + "1. e5 e4 1-0"},
+		{"bad move", headers + "1. e5 z99 *"},
+		{"bad move number", headers + "x. e5 *"},
+		{"bad header", "[Result *]\n\n*"},
+		{"bad hint count", "[CrossHints \"-1\"]\n\n*"},
+		{"bad rules", "[Rules \"size=9 line=3 depth=2\"]\n\n*"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if record, err := ParseRecord(strings.NewReader(test.record)); err == nil {
+				t.Fatalf("ParseRecord accepted %q as %+v", test.record, record)
+			}
+		})
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+	}{
+		// e5 sends cross to the center board, where e4 is not.
+		{"illegal move", "[Result \"*\"]\n\n1. e5 a1 *"},
+		{"wrong result", "[Result \"1-0\"]\n\n1. e5 e4 1-0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record, err := ParseRecord(strings.NewReader(test.record))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := record.Replay(); err == nil {
+				t.Fatalf("Replay accepted %q", test.record)
+			}
+		})
+	}
+}
+
+func countGames(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var games int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM games`).Scan(&games); err != nil {
+		t.Fatal(err)
+	}
+	return games
+}
+
+func TestImportGame(t *testing.T) {
+	db := testDatabase(t)
+	state, moves := randomGame(t, ClassicRules, 1, 81)
+	record := &GameRecord{Rules: ClassicRules, Result: ResultOf(state), Hints: [2]int{0, 3}, Moves: moves}
+	crossId, circleId, err := ImportGame(db, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{crossId, circleId} {
+		transaction, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported, err := GetRecord(transaction, id)
+		transaction.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(exported.Moves, moves) || exported.Result != record.Result || exported.Hints != record.Hints {
+			t.Fatalf("exported %+v, want the moves, result and hints of %+v", exported, record)
+		}
+	}
+
+	bad := &GameRecord{Rules: ClassicRules, Result: ResultCrossWins, Moves: moves[:3]}
+	if _, _, err := ImportGame(db, bad); err == nil {
+		t.Fatal("imported a record whose result doesn't match its moves")
+	}
+	if games := countGames(t, db); games != 1 {
+		t.Fatalf("%d games stored, want 1", games)
+	}
+}
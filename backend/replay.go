@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const replayCacheGames = 256
+
+// ReplayState is the position of a game after its first Ply moves.
+type ReplayState struct {
+	GameState State `json:"game_state"`
+	Ply       int   `json:"ply"`
+	Plies     int   `json:"plies"`
+	LastMove  *Move `json:"last_move"`
+}
+
+type replayEntry struct {
+	moves     []Move
+	positions []State // positions[i] is the state after the first i moves
+	used      time.Time
+}
+
+// replayCache keeps the intermediate positions of recently replayed games so scrubbing
+// back and forth through a long game doesn't replay it from the start on every request.
+type replayCache struct {
+	mutex sync.Mutex
+	games map[int64]*replayEntry
+}
+
+var replays = replayCache{games: map[int64]*replayEntry{}}
+
+// StateAt returns the position after ply moves of the given move log of a game played with rules.
+func (this *replayCache) StateAt(gameId int64, rules Rules, moves []Move, ply int) (State, error) {
+	if ply < 0 || ply > len(moves) {
+		return State{}, errors.New("Invalid ply")
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	entry := this.games[gameId]
+	if entry == nil {
+		this.evict()
+		entry = &replayEntry{positions: []State{NewState(rules)}}
+		this.games[gameId] = entry
+	}
+	entry.used = time.Now()
+
+	// The log only grows while a game is played, but it may also have been rewritten since it was
+	// cached; positions past the first difference are stale.
+	valid := 0
+	for valid < len(entry.moves) && valid < len(moves) && entry.moves[valid] == moves[valid] {
+		valid++
+	}
+	entry.moves = entry.moves[:valid]
+	entry.positions = entry.positions[:valid+1]
+
+	for len(entry.moves) < ply {
+		i := len(entry.moves)
+		next, err := PerformMove(entry.positions[i], moves[i])
+		if err != nil {
+			return State{}, fmt.Errorf("Move %d (%s): %v", i+1, MoveNotation(rules, moves[i]), err)
+		}
+		entry.moves = append(entry.moves, moves[i])
+		entry.positions = append(entry.positions, next)
+	}
+	return entry.positions[ply], nil
+}
+
+// evict drops the least recently used game once the cache is full. Callers hold the mutex.
+func (this *replayCache) evict() {
+	if len(this.games) < replayCacheGames {
+		return
+	}
+	var oldest int64
+	var oldestUsed time.Time
+	for id, entry := range this.games {
+		if oldestUsed.IsZero() || entry.used.Before(oldestUsed) {
+			oldest = id
+			oldestUsed = entry.used
+		}
+	}
+	delete(this.games, oldest)
+}
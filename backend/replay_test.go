@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateAt(t *testing.T) {
+	cache := replayCache{games: map[int64]*replayEntry{}}
+	_, moves := randomGame(t, ClassicRules, 2, 40)
+	// Out of order, so the cached positions are both reused and extended.
+	for _, ply := range []int{10, 0, 40, 25, 40, 1} {
+		got, err := cache.StateAt(1, ClassicRules, moves, ply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := ReplayMoves(ClassicRules, moves[:ply])
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("state at ply %d differs from the replayed one", ply)
+		}
+	}
+	for _, ply := range []int{-1, 41} {
+		if _, err := cache.StateAt(1, ClassicRules, moves, ply); err == nil {
+			t.Fatalf("ply %d accepted", ply)
+		}
+	}
+}
+
+func TestStateAtRewrittenLog(t *testing.T) {
+	cache := replayCache{games: map[int64]*replayEntry{}}
+	_, moves := randomGame(t, ClassicRules, 3, 20)
+	if _, err := cache.StateAt(1, ClassicRules, moves, 20); err != nil {
+		t.Fatal(err)
+	}
+	// A takeback drops the last moves and another one is played instead.
+	state, _ := ReplayMoves(ClassicRules, moves[:18])
+	rewritten := moves[:18:18]
+	for _, move := range legalMoves(state) {
+		if move != moves[18] {
+			rewritten = append(rewritten, move)
+			break
+		}
+	}
+	got, err := cache.StateAt(1, ClassicRules, rewritten, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := ReplayMoves(ClassicRules, rewritten); !reflect.DeepEqual(got, want) {
+		t.Fatal("state after the rewritten log comes from the old log")
+	}
+}
+
+func TestStateAtEvicts(t *testing.T) {
+	cache := replayCache{games: map[int64]*replayEntry{}}
+	_, moves := randomGame(t, ClassicRules, 4, 5)
+	for id := range int64(replayCacheGames + 10) {
+		if _, err := cache.StateAt(id, ClassicRules, moves, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(cache.games) != replayCacheGames {
+		t.Fatalf("%d games cached, want %d", len(cache.games), replayCacheGames)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// takebackPlies is how many moves a takeback requested by player undoes: their own last move, plus
+// the opponent's reply if there was one, so that it is the requester's turn again.
+func takebackPlies(state State, player Player) int {
+	if state.ToMove == player {
+		return 2
+	}
+	return 1
+}
+
+// RequestTakeback records that the player behind id wants to undo their last move.
+// The opponent sees the request in GET /play and answers it with AnswerTakeback.
+func RequestTakeback(db *sql.DB, id int64) error {
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	state, player, err := GetState(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	info, err := GetGameInfo(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	if info.Options.Rated {
+		transaction.Rollback()
+		return errors.New("Takebacks are disabled in rated games")
+	}
+	if state.IsOver() {
+		transaction.Rollback()
+		return errors.New("Game already finished")
+	}
+	moves, err := GetMoves(transaction, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	if takebackPlies(*state, player) > len(moves) {
+		transaction.Rollback()
+		return errors.New("Nothing to take back")
+	}
+	_, err = transaction.Exec(`UPDATE games SET takeback_by = ? WHERE cross_id = ?`, player, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	return transaction.Commit()
+}
+
+// AnswerTakeback resolves the pending takeback request of the game behind id. Only the opponent
+// of the requester can accept it, which rolls the game back by replaying the shortened move log;
+// either player can decline (or withdraw) it.
+func AnswerTakeback(db *sql.DB, id int64, accept bool) (*State, error) {
+	transaction, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	state, player, err := GetState(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	info, err := GetGameInfo(transaction, id)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	if info.Takeback == None {
+		transaction.Rollback()
+		return nil, errors.New("No takeback requested")
+	}
+	if !accept {
+		_, err = transaction.Exec(`UPDATE games SET takeback_by = ? WHERE cross_id = ?`, None, info.GameId)
+		if err != nil {
+			transaction.Rollback()
+			return nil, err
+		}
+		return state, transaction.Commit()
+	}
+	if info.Takeback == player {
+		transaction.Rollback()
+		return nil, errors.New("Cannot accept your own takeback request")
+	}
+	if state.IsOver() {
+		transaction.Rollback()
+		return nil, errors.New("Game already finished")
+	}
+
+	moves, err := GetMoves(transaction, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	keep := len(moves) - takebackPlies(*state, info.Takeback)
+	if keep < 0 {
+		transaction.Rollback()
+		return nil, errors.New("Nothing to take back")
+	}
+	*state, err = ReplayMoves(state.Rules, moves[:keep])
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	var stateString []byte
+	stateString, err = json.Marshal(*state)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	_, err = transaction.Exec(`DELETE FROM moves WHERE game_id = ? AND ply >= ?`, info.GameId, keep)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	_, err = transaction.Exec(`UPDATE games SET state = ?, takeback_by = ? WHERE cross_id = ?`, string(stateString), None, info.GameId)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+	err = transaction.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
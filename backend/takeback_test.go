@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// playMoves has the players of a game make moves in turn and returns the last state.
+func playMoves(t *testing.T, db *sql.DB, crossId int64, circleId int64, moves []Move) *State {
+	t.Helper()
+	var state *State
+	for i, move := range moves {
+		id := crossId
+		if move.Player == Circle {
+			id = circleId
+		}
+		var err error
+		if state, err = MakeMove(db, id, move); err != nil {
+			t.Fatalf("move %d: %v", i+1, err)
+		}
+	}
+	return state
+}
+
+func moveCount(t *testing.T, db *sql.DB, gameId int64) int {
+	t.Helper()
+	transaction, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transaction.Rollback()
+	moves, err := GetMoves(transaction, gameId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(moves)
+}
+
+func TestTakeback(t *testing.T) {
+	db := testDatabase(t)
+	_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, moves := randomGame(t, ClassicRules, 5, 3)
+	playMoves(t, db, crossId, circleId, moves)
+
+	// Circle is to move, so their takeback undoes their move and cross's reply.
+	if err := RequestTakeback(db, circleId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AnswerTakeback(db, circleId, true); err == nil {
+		t.Fatal("the requester accepted their own takeback")
+	}
+	state, err := AnswerTakeback(db, crossId, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := ReplayMoves(ClassicRules, moves[:1]); !reflect.DeepEqual(*state, want) {
+		t.Fatalf("state after the takeback is not the one after the first move")
+	}
+	if n := moveCount(t, db, crossId); n != 1 {
+		t.Fatalf("%d moves logged after the takeback, want 1", n)
+	}
+	if _, err := AnswerTakeback(db, crossId, true); err == nil {
+		t.Fatal("accepted a takeback nobody requested")
+	}
+
+	// Declining leaves the game as it was.
+	if err := RequestTakeback(db, crossId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AnswerTakeback(db, circleId, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := moveCount(t, db, crossId); n != 1 {
+		t.Fatalf("%d moves logged after a declined takeback, want 1", n)
+	}
+}
+
+func TestTakebackRefused(t *testing.T) {
+	db := testDatabase(t)
+	_, crossId, _, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RequestTakeback(db, crossId); err == nil {
+		t.Fatal("took back a move before any was made")
+	}
+
+	_, ratedCross, ratedCircle, err := CreateGame(db, GameOptions{Rated: true, Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, moves := randomGame(t, ClassicRules, 6, 2)
+	playMoves(t, db, ratedCross, ratedCircle, moves)
+	if err := RequestTakeback(db, ratedCross); err == nil {
+		t.Fatal("took back a move in a rated game")
+	}
+}
+
+func TestTakebackDrawnGame(t *testing.T) {
+	db := testDatabase(t)
+	var moves []Move
+	for seed := uint64(1); ; seed++ {
+		state, played := randomGame(t, ClassicRules, seed, 81)
+		if state.IsOver() && state.Winner == None {
+			moves = played
+			break
+		}
+	}
+	_, crossId, circleId, err := CreateGame(db, GameOptions{Rules: ClassicRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playMoves(t, db, crossId, circleId, moves)
+	if err := RequestTakeback(db, crossId); err == nil {
+		t.Fatal("took back a move in a drawn game")
+	}
+
+	// A request left pending when the game ended can't be accepted either.
+	if _, err := db.Exec(`UPDATE games SET takeback_by = ? WHERE cross_id = ?`, Cross, crossId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AnswerTakeback(db, circleId, true); err == nil {
+		t.Fatal("accepted a takeback in a drawn game")
+	}
+	if n := moveCount(t, db, crossId); n != len(moves) {
+		t.Fatalf("%d moves logged, want %d", n, len(moves))
+	}
+}
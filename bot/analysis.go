@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Candidate is a move of the analysed position with its score.
+type Candidate struct {
+	Move     Move   `json:"move"`
+	Notation string `json:"notation"`
+	Score    int    `json:"score"`
+	Mate     int    `json:"mate,omitempty"`
+}
+
+// Analysis is the engine's view of a position. Scores are from the perspective of the side to
+// move, in evaluation units; Mate, when not zero, counts the moves to a forced win (negative: to
+// a forced loss).
+type Analysis struct {
+	Score      int         `json:"score"`
+	Mate       int         `json:"mate,omitempty"`
+	Depth      int         `json:"depth"`
+	PV         []Move      `json:"pv"`
+	PVNotation []string    `json:"pv_notation"`
+	Candidates []Candidate `json:"candidates"` // best first
+	Nodes      int         `json:"nodes"`
+	TimeMs     int64       `json:"time_ms"`
+}
+
+// mateIn turns a mate score into the number of moves to the end, and other scores into 0.
+func mateIn(score int) int {
+	switch {
+	case score > abInf-2*maxPly:
+		return (abInf - score + 1) / 2
+	case score < -(abInf - 2*maxPly):
+		return -(abInf + score + 1) / 2
+	}
+	return 0
+}
+
+// Analyze scores every move of state with searches of increasing depth until ctx is done, and
+// reports the top moves of the deepest search that completed. It fails when the game is over or
+// ctx is done before the first search completes.
+func Analyze(ctx context.Context, state State, top int, weights *Weights) (Analysis, bool) {
+	if state.IsOver() {
+		return Analysis{}, false
+	}
+	start := time.Now()
+	var analysis Analysis
+	var children []scoredChild
+	if pos, ok := NewPosition(state); ok {
+		children, analysis = analyzePosition(ctx, pos, weights)
+	} else {
+		children, analysis = analyzeState(ctx, state)
+	}
+	if len(children) == 0 {
+		return Analysis{}, false
+	}
+	analysis.Score, analysis.Mate = children[0].score, mateIn(children[0].score)
+	if len(analysis.PV) == 0 {
+		analysis.PV = []Move{children[0].mv}
+	}
+	for _, move := range analysis.PV {
+		analysis.PVNotation = append(analysis.PVNotation, MoveNotation(state.Rules, move))
+	}
+	for _, child := range children[:min(top, len(children))] {
+		analysis.Candidates = append(analysis.Candidates, Candidate{
+			Move: child.mv, Notation: MoveNotation(state.Rules, child.mv), Score: child.score, Mate: mateIn(child.score),
+		})
+	}
+	analysis.TimeMs = time.Since(start).Milliseconds()
+	return analysis, true
+}
+
+func analyzePosition(ctx context.Context, pos Position, weights *Weights) ([]scoredChild, Analysis) {
+	var analysis Analysis
+	search := newPositionSearch(ctx, pos, sharedTT(), weights)
+	var best []bitChild
+	maxDepth := max(1, min(maxPly, pos.openCells()))
+	for depth := 1; depth <= maxDepth; depth++ {
+		ttMove := noMove
+		if len(best) > 0 {
+			ttMove = best[0].move
+		}
+		children := search.orderChildren(search.pos.Moves(nil), nil, ttMove, 0)
+		for i := range children {
+			search.pos.Make(children[i].move)
+			children[i].score = -search.alphaBeta(depth-1, -abInf, abInf, 1)
+			search.pos.Unmake()
+			if search.stopped {
+				break
+			}
+		}
+		if search.stopped {
+			break
+		}
+		slices.SortStableFunc(children, func(a, b bitChild) int { return b.score - a.score })
+		best, analysis.Depth = children, depth
+		search.store(depth, best[0].score, -abInf, abInf, best[0].move, 0)
+		analysis.PV = search.principalVariation(depth)
+		if mateIn(best[0].score) != 0 {
+			break
+		}
+	}
+	analysis.Nodes = search.nodes
+	var scored []scoredChild
+	for _, child := range best {
+		scored = append(scored, scoredChild{mv: pos.Move(child.move), score: child.score})
+	}
+	return scored, analysis
+}
+
+// analyzeState is analyzePosition for the geometries the generic search handles.
+func analyzeState(ctx context.Context, state State) ([]scoredChild, Analysis) {
+	var analysis Analysis
+	var best []scoredChild
+	root := state.ToMove
+	for depth := 1; depth <= max(1, countEmpty(state)); depth++ {
+		var children []scoredChild
+		for _, move := range LegalMoves(state) {
+			next, err := PerformMove(state, move)
+			if err != nil {
+				continue
+			}
+			score := alphaBetaPlyCtx(ctx, next, depth-1, -abInf, abInf, root, 1, LegalMoves(next))
+			children = append(children, scoredChild{mv: move, next: next, score: score})
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		slices.SortStableFunc(children, func(a, b scoredChild) int { return b.score - a.score })
+		best, analysis.Depth = children, depth
+		if len(best) == 0 || mateIn(best[0].score) != 0 {
+			break
+		}
+	}
+	return best, analysis
+}
+
+// The analysis service answers POST /analyze and POST /solve when BOT_ANALYSIS_ADDR is set:
+//
+//	BOT_ANALYSIS_ADDR          address to listen on, ":8081" say
+//	BOT_ANALYSIS_TIME          thinking time per analysis (default 2s)
+//	BOT_ANALYSIS_CONCURRENCY   analyses run at once (default 2); requests beyond get 429
+//
+// The request body is {"state": State, "top": N, "time_ms": T}: N candidate moves are returned
+// (default 3), after thinking for T milliseconds if that is less than BOT_ANALYSIS_TIME. /solve
+// ignores N and answers with a Solution, or 503 if it can't solve the position in time.
+const (
+	defaultAnalysisTime        = 2 * time.Second
+	defaultAnalysisConcurrency = 2
+	defaultAnalysisTop         = 3
+)
+
+type analysisRequest struct {
+	State  *State `json:"state"`
+	Top    int    `json:"top"`
+	TimeMs int    `json:"time_ms"`
+}
+
+type analysisServer struct {
+	weights *Weights
+	budget  time.Duration
+	slots   chan struct{}
+}
+
+// startAnalysisServer serves analyses in the background if the environment asks for it.
+func startAnalysisServer(config botConfig) error {
+	addr := os.Getenv("BOT_ANALYSIS_ADDR")
+	if addr == "" {
+		return nil
+	}
+	budget := defaultAnalysisTime
+	if value := os.Getenv("BOT_ANALYSIS_TIME"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid BOT_ANALYSIS_TIME %q", value)
+		}
+		budget = d
+	}
+	concurrency := defaultAnalysisConcurrency
+	if value := os.Getenv("BOT_ANALYSIS_CONCURRENCY"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid BOT_ANALYSIS_CONCURRENCY %q", value)
+		}
+		concurrency = n
+	}
+	server := &analysisServer{weights: &config.Weights, budget: budget, slots: make(chan struct{}, concurrency)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /analyze", server.analyze)
+	mux.HandleFunc("POST /solve", server.solve)
+	go func() {
+		fmt.Printf("analysis service listening: addr=%s time=%s concurrency=%d\n", addr, budget, concurrency)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Printf("analysis service stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// start decodes a request, takes a slot for it and sets up its time budget; it answers the request
+// itself when it can't. done releases the slot.
+func (this *analysisServer) start(w http.ResponseWriter, r *http.Request) (analysisRequest, context.Context, func(), bool) {
+	var request analysisRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.State == nil || (request.State.ToMove != Cross && request.State.ToMove != Circle) {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "Invalid analysis request"})
+		return request, nil, nil, false
+	}
+	if request.State.IsOver() {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "The game is over"})
+		return request, nil, nil, false
+	}
+	select {
+	case this.slots <- struct{}{}:
+	default:
+		// Not 503, which means the position couldn't be analyzed in time: this one may be later.
+		writeJSON(w, http.StatusTooManyRequests, apiError{Error: "Analysis is busy, try again later"})
+		return request, nil, nil, false
+	}
+
+	budget := this.budget
+	if request.TimeMs > 0 {
+		budget = min(budget, time.Duration(request.TimeMs)*time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	return request, ctx, func() {
+		cancel()
+		<-this.slots
+	}, true
+}
+
+func (this *analysisServer) analyze(w http.ResponseWriter, r *http.Request) {
+	request, ctx, done, ok := this.start(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+	if request.Top <= 0 {
+		request.Top = defaultAnalysisTop
+	}
+	analysis, ok := Analyze(ctx, *request.State, request.Top, this.weights)
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, apiError{Error: "Analysis ran out of time"})
+		return
+	}
+	writeJSON(w, http.StatusOK, analysis)
+}
+
+// Solution is a solved position: its outcome for the side to move, and the line the solver
+// plays out, the winner hurrying and the loser holding out.
+type Solution struct {
+	Outcome  string `json:"outcome"`
+	Distance int    `json:"distance"`
+	Line     []Move `json:"line"`
+}
+
+func (this *analysisServer) solve(w http.ResponseWriter, r *http.Request) {
+	request, ctx, done, ok := this.start(w, r)
+	if !ok {
+		return
+	}
+	defer done()
+	if _, classic := NewPosition(*request.State); !classic {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "Only classic games can be solved"})
+		return
+	}
+	line, info, ok := SolveLine(ctx, *request.State)
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, apiError{Error: "Solving ran out of time"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Solution{Outcome: info.Outcome.String(), Distance: info.Distance, Line: line})
+}
@@ -81,6 +81,29 @@ func StartGame(ctx context.Context, baseURL string) (MyState, error) {
 	return readAPIResponse[MyState](res)
 }
 
+// ClaimBotGame calls backend POST /play/bot, which hands out the seat of a game a player started
+// against the bot to whoever knows the backend's secret. It reports false when no player is
+// waiting.
+func ClaimBotGame(ctx context.Context, baseURL string, secret string) (MyState, bool, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	url := fmt.Sprintf("%s/play/bot", normalizeBaseURL(baseURL))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return MyState{}, false, err
+	}
+	req.Header.Set("X-Bot-Secret", secret)
+	res, err := client.Do(req)
+	if err != nil {
+		return MyState{}, false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNoContent {
+		return MyState{}, false, nil
+	}
+	ms, err := readAPIResponse[MyState](res)
+	return ms, err == nil, err
+}
+
 // GetStateByID calls backend GET /play?id=... and returns the MyState (includes Role derived from id).
 func GetStateByID(ctx context.Context, baseURL string, id int64) (MyState, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -121,36 +144,37 @@ func SendMove(ctx context.Context, baseURL string, id int64, mv Move) (State, er
 }
 
 // PlayBestMove fetches state for this id, finds the best move for ms.Role, and submits it.
-// Returns the move played and the resulting state.
-func PlayBestMove(ctx context.Context, baseURL string, id int64, depth int) (Move, State, error) {
+// It searches with engine within limits, and returns the move played, the search info and the
+// resulting state.
+func PlayBestMove(ctx context.Context, baseURL string, id int64, engine Engine, limits Limits) (Move, Info, State, error) {
 	ms, err := GetStateByID(ctx, baseURL, id)
 	if err != nil {
-		return Move{}, State{}, err
+		return Move{}, Info{}, State{}, err
 	}
 
 	st := ms.GameState
 	if st.Winner != None {
-		return Move{}, st, errors.New("game already finished")
+		return Move{}, Info{}, st, errors.New("game already finished")
 	}
 	if ms.Role == None {
-		return Move{}, st, errors.New("invalid role for id")
+		return Move{}, Info{}, st, errors.New("invalid role for id")
 	}
 	if st.ToMove != ms.Role {
-		return Move{}, st, errors.New("not your turn")
+		return Move{}, Info{}, st, errors.New("not your turn")
 	}
 
 	// IMPORTANT: when location == -1 the branching factor is huge; the search can take a long time.
-	// Use context-bounded search so we don't "freeze" past action timeout.
-	mv, ok := BestMoveCtx(ctx, st, depth)
-	if !ok {
-		return Move{}, st, errors.New("no legal moves")
+	// Search within limits.Time so we don't "freeze" past action timeout.
+	mv, info := engine.Search(ctx, st, limits)
+	if mv == NoMove {
+		return Move{}, info, st, errors.New("no legal moves")
 	}
 	// Ensure we send the correct player (backend validates it).
 	mv.Player = ms.Role
 
 	next, err := SendMove(ctx, baseURL, id, mv)
 	if err != nil {
-		return Move{}, State{}, err
+		return Move{}, Info{}, State{}, err
 	}
-	return mv, next, nil
+	return mv, info, next, nil
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ArenaOptions controls an arena match between two bot configurations.
+type ArenaOptions struct {
+	Rules       Rules
+	Games       int
+	Concurrency int           // games played at once
+	MoveTime    time.Duration // thinking time per move
+	Depth       int           // deepest search iteration; 0 leaves it to MoveTime
+	// OpeningPlies random moves start each pair of games, which the configurations then play
+	// once with each color.
+	OpeningPlies int
+	Seed         int64
+	SPRT         *SPRT // stops the match once it decides; nil plays every game
+}
+
+// ArenaResult counts the games of a match from the first configuration's perspective.
+type ArenaResult struct {
+	Wins   int
+	Draws  int
+	Losses int
+	// Decision is set when the SPRT stopped the match: "H1" if the first configuration is at
+	// least Elo1 stronger, "H0" if it is at most Elo0.
+	Decision string
+}
+
+func (this ArenaResult) Games() int {
+	return this.Wins + this.Draws + this.Losses
+}
+
+// Score is the share of points won, a draw counting half.
+func (this ArenaResult) Score() float64 {
+	if this.Games() == 0 {
+		return 0.5
+	}
+	return (float64(this.Wins) + float64(this.Draws)/2) / float64(this.Games())
+}
+
+// variance is the per-game variance of the score.
+func (this ArenaResult) variance() float64 {
+	if this.Games() == 0 {
+		return 0
+	}
+	s := this.Score()
+	sum := float64(this.Wins)*(1-s)*(1-s) + float64(this.Draws)*(0.5-s)*(0.5-s) + float64(this.Losses)*s*s
+	return sum / float64(this.Games())
+}
+
+// Elo is the rating difference the score implies, with the margin of its 95% confidence
+// interval. Both are infinite while one side has won every point.
+func (this ArenaResult) Elo() (float64, float64) {
+	s := this.Score()
+	if this.Games() == 0 || s == 0 || s == 1 {
+		return eloFromScore(s), math.Inf(1)
+	}
+	deviation := 1.96 * math.Sqrt(this.variance()/float64(this.Games()))
+	return eloFromScore(s), (eloFromScore(s+deviation) - eloFromScore(s-deviation)) / 2
+}
+
+func (this ArenaResult) String() string {
+	elo, margin := this.Elo()
+	return fmt.Sprintf("games=%d W=%d D=%d L=%d score=%.3f elo=%+.1f ±%.1f", this.Games(), this.Wins, this.Draws, this.Losses,
+		this.Score(), elo, margin)
+}
+
+func eloFromScore(score float64) float64 {
+	if score <= 0 {
+		return math.Inf(-1)
+	}
+	if score >= 1 {
+		return math.Inf(1)
+	}
+	return 400 * math.Log10(score/(1-score))
+}
+
+func scoreFromElo(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// SPRT is a sequential probability ratio test of H0, the first configuration is Elo0 stronger,
+// against H1, it is Elo1 stronger, with false positive rate Alpha and false negative rate Beta.
+type SPRT struct {
+	Elo0  float64
+	Elo1  float64
+	Alpha float64
+	Beta  float64
+}
+
+// LLR is the log-likelihood ratio of H1 to H0 given result, in the usual normal approximation
+// of the game scores.
+func (this SPRT) LLR(result ArenaResult) float64 {
+	variance := result.variance()
+	if variance == 0 {
+		return 0
+	}
+	s0, s1 := scoreFromElo(this.Elo0), scoreFromElo(this.Elo1)
+	return float64(result.Games()) * (s1 - s0) * (2*result.Score() - s0 - s1) / (2 * variance)
+}
+
+// Bounds are the LLR values at which the test accepts H0 and H1.
+func (this SPRT) Bounds() (float64, float64) {
+	return math.Log(this.Beta / (1 - this.Alpha)), math.Log((1 - this.Beta) / this.Alpha)
+}
+
+func (this SPRT) decide(result ArenaResult) string {
+	llr := this.LLR(result)
+	lower, upper := this.Bounds()
+	switch {
+	case llr >= upper:
+		return "H1"
+	case llr <= lower:
+		return "H0"
+	}
+	return ""
+}
+
+type arenaGame struct {
+	outcome int // 1 when the first configuration won, -1 when it lost
+	err     error
+}
+
+// RunArena plays a match of a against b in-process. progress, if not nil, is called with the
+// standings after each game.
+func RunArena(ctx context.Context, a botConfig, b botConfig, options ArenaOptions, progress func(ArenaResult)) (ArenaResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	games := make(chan int, options.Games)
+	for game := range options.Games {
+		games <- game
+	}
+	close(games)
+	results := make(chan arenaGame, options.Games)
+	var wg sync.WaitGroup
+	for range max(options.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each configuration searches on its own table, so neither learns from the other's
+			// searches or from other games.
+			tables := [2]*transpositionTable{newTranspositionTable(ttEntries), newTranspositionTable(ttEntries)}
+			for game := range games {
+				if ctx.Err() != nil {
+					return
+				}
+				tables[0].clear()
+				tables[1].clear()
+				outcome, err := playArenaGame(ctx, a, b, game, tables, options)
+				results <- arenaGame{outcome: outcome, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var result ArenaResult
+	var failure error
+	for game := range results {
+		if ctx.Err() != nil {
+			// Games cut short by the decision or a failure don't count.
+			continue
+		}
+		if game.err != nil {
+			failure = game.err
+			cancel()
+			continue
+		}
+		switch game.outcome {
+		case 1:
+			result.Wins++
+		case -1:
+			result.Losses++
+		default:
+			result.Draws++
+		}
+		if options.SPRT != nil {
+			result.Decision = options.SPRT.decide(result)
+		}
+		if progress != nil {
+			progress(result)
+		}
+		if result.Decision != "" {
+			cancel()
+		}
+	}
+	if failure == nil && result.Decision == "" {
+		failure = ctx.Err()
+	}
+	return result, failure
+}
+
+// arenaOpening plays the random opening of a pair of games; openings that end the game are
+// drawn again.
+func arenaOpening(rules Rules, plies int, rng *rand.Rand) State {
+	for {
+		state := NewState(rules)
+		for range plies {
+			if state.IsOver() {
+				break
+			}
+			moves := LegalMoves(state)
+			state, _ = PerformMove(state, moves[rng.Intn(len(moves))])
+		}
+		if !state.IsOver() {
+			return state
+		}
+	}
+}
+
+// playArenaGame plays game number game of the match, each configuration searching on its table;
+// the first configuration plays Cross in even games.
+func playArenaGame(ctx context.Context, a botConfig, b botConfig, game int, tables [2]*transpositionTable, options ArenaOptions) (int, error) {
+	seed := options.Seed + int64(game)
+	state := arenaOpening(options.Rules, options.OpeningPlies, rand.New(rand.NewSource(options.Seed+int64(game/2))))
+	first := Player(game % 2)
+	engines := [2]Engine{}
+	engines[first], engines[1-first] = a.newEngine(seed, tables[0]), b.newEngine(seed, tables[1])
+	configs := [2]botConfig{}
+	configs[first], configs[1-first] = a, b
+
+	for !state.IsOver() {
+		limits := configs[state.ToMove].limits(options.MoveTime)
+		if options.Depth > 0 {
+			limits.Depth = options.Depth
+		}
+		move, _ := engines[state.ToMove].Search(ctx, state, limits)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if move == NoMove {
+			return 0, fmt.Errorf("game %d: no move for player %d", game, state.ToMove)
+		}
+		next, err := PerformMove(state, move)
+		if err != nil {
+			return 0, fmt.Errorf("game %d: illegal move %+v: %v", game, move, err)
+		}
+		state = next
+	}
+	switch state.Winner {
+	case first:
+		return 1, nil
+	case 1 - first:
+		return -1, nil
+	}
+	return 0, nil
+}
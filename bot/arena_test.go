@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSPRT(t *testing.T) {
+	sprt := SPRT{Elo0: 0, Elo1: 10, Alpha: 0.05, Beta: 0.05}
+	if lower, upper := sprt.Bounds(); math.Abs(lower+2.944) > 1e-3 || math.Abs(upper-2.944) > 1e-3 {
+		t.Fatalf("bounds %.3f and %.3f, want ∓2.944", lower, upper)
+	}
+
+	tests := []struct {
+		name   string
+		result ArenaResult
+		want   string
+	}{
+		{"no games", ArenaResult{}, ""},
+		{"clearly stronger", ArenaResult{Wins: 600, Draws: 200, Losses: 200}, "H1"},
+		{"clearly weaker", ArenaResult{Wins: 200, Draws: 200, Losses: 600}, "H0"},
+		{"equal so far", ArenaResult{Wins: 100, Draws: 100, Losses: 100}, ""},
+		{"equal for long", ArenaResult{Wins: 3000, Draws: 3000, Losses: 3000}, "H0"},
+		{"too few games", ArenaResult{Wins: 6, Draws: 2, Losses: 4}, ""},
+		// Without variance there is nothing to go by.
+		{"all draws", ArenaResult{Draws: 500}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sprt.decide(test.result); got != test.want {
+				t.Fatalf("decided %q with LLR %.3f, want %q", got, sprt.LLR(test.result), test.want)
+			}
+		})
+	}
+}
+
+func TestArenaResultElo(t *testing.T) {
+	result := ArenaResult{Wins: 30, Draws: 20, Losses: 10}
+	elo, margin := result.Elo()
+	// A score of 2/3 is 400·log10(2) above even.
+	if math.Abs(elo-120.41) > 0.01 || margin <= 0 || math.IsInf(margin, 0) {
+		t.Fatalf("elo %.2f ±%.2f, want 120.41 with a finite margin", elo, margin)
+	}
+	if _, margin := (ArenaResult{Wins: 5}).Elo(); !math.IsInf(margin, 1) {
+		t.Fatalf("margin %.2f after winning every game, want infinite", margin)
+	}
+	if score := scoreFromElo(eloFromScore(0.64)); math.Abs(score-0.64) > 1e-9 {
+		t.Fatalf("score 0.64 came back as %f", score)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// benchDepth is the depth the suite is searched to by default.
+const benchDepth = 12
+
+// benchPosition is a classic game after moves in record notation.
+type benchPosition struct {
+	Name  string
+	Moves string
+}
+
+// benchPositions are the benchmark suite, plies of self-play games. They must not change, or the
+// node counts of versions stop being comparable.
+var benchPositions = []benchPosition{
+	{"opening", "a1 b1 e1 f1 h2 d5"},
+	// Sent to a board that is still open.
+	{"forced-board", "a1 b1 e1 f1 h2 d5 c4 i2 g5 b5 f5 g6 a9 b9 e9 f9 i9 i8 h5 d6 b7 e2 d4 b3 e8 f6 g9 c7 i1 g3 a8 c5 i6 g8 a5 b4 d2 b6 e7 d1"},
+	// Sent to a won board, so free to play on any board.
+	{"free-move", "a1 b1 e1 f1 h2 d5 c4 i2 g5 b5 f5 g6 a9 b9 e9 f9 i9 i8 h5 d6 b7 e2 d4 b3 e8 f6 g9 c7 i1 g3 a8 c5 i6 g8 a5 b4 d2 b6 e7 d1 b2 e4 f2 h4 d3 a7 c3 h8 e5 e6"},
+	// The side to move loses by force.
+	{"endgame", "a1 b1 f1 i1 h1 d2 a5 b5 e5 f5 g6 a9 c8 i6 h8 f6 g7 b3 e9 d8 c6 i9 g9 a7 a2 a6 b7 d3 b9 f8 i5 i4 h2 f4 h3 e8 a8 b4 f2 g5 c5 h4"},
+}
+
+func (this benchPosition) state() (State, error) {
+	state := NewState(ClassicRules)
+	for _, text := range strings.Fields(this.Moves) {
+		move, err := ParseMoveNotation(ClassicRules, text, state.ToMove)
+		if err != nil {
+			return state, err
+		}
+		if state, err = PerformMove(state, move); err != nil {
+			return state, fmt.Errorf("%s: move %s: %v", this.Name, text, err)
+		}
+	}
+	return state, nil
+}
+
+// BenchResult is the search of one benchmark position.
+type BenchResult struct {
+	Name  string
+	Move  Move
+	Score int
+	Nodes int
+	Time  time.Duration
+}
+
+func (this BenchResult) NPS() float64 {
+	return float64(this.Nodes) / this.Time.Seconds()
+}
+
+func (this BenchResult) String() string {
+	score := fmt.Sprintf("score=%d", this.Score)
+	if mate := mateIn(this.Score); mate != 0 {
+		score = fmt.Sprintf("mate=%d", mate)
+	}
+	return fmt.Sprintf("position=%s move=%s %s nodes=%d time=%s nps=%.0f",
+		this.Name, MoveNotation(ClassicRules, this.Move), score, this.Nodes, this.Time.Round(time.Microsecond), this.NPS())
+}
+
+// runBench searches a benchmark position to depth as BestMove does, but on tt cleared first, so
+// the node count only depends on the search.
+func runBench(position benchPosition, depth int, tt *transpositionTable, weights *Weights) (BenchResult, error) {
+	state, err := position.state()
+	if err != nil {
+		return BenchResult{}, err
+	}
+	pos, _ := NewPosition(state)
+	tt.clear()
+	start := time.Now()
+	search := newPositionSearch(context.Background(), pos, tt, weights)
+	move, score, ok := search.bestMove(depth)
+	if !ok {
+		return BenchResult{}, fmt.Errorf("%s: no move", position.Name)
+	}
+	return BenchResult{Name: position.Name, Move: move, Score: score, Nodes: search.nodes, Time: time.Since(start)}, nil
+}
+
+// RunBench searches every benchmark position, passing each result to onResult, and returns the
+// total node count, which changes exactly when the search does, and search time.
+func RunBench(depth int, weights *Weights, onResult func(BenchResult)) (int, time.Duration, error) {
+	tt := newTranspositionTable(ttEntries)
+	nodes, elapsed := 0, time.Duration(0)
+	for _, position := range benchPositions {
+		result, err := runBench(position, depth, tt, weights)
+		if err != nil {
+			return nodes, elapsed, err
+		}
+		nodes += result.Nodes
+		elapsed += result.Time
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+	return nodes, elapsed, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+)
+
+const bookVersion = 1
+
+// BookMove is a move the book suggests; the bot picks among a position's moves in proportion to
+// their weights.
+type BookMove struct {
+	Move   Move `json:"move"`
+	Weight int  `json:"weight"`
+}
+
+// bookPosition is a position of the book file, keyed by its Zobrist hash in hex; Ply is only
+// there for people reading the file.
+type bookPosition struct {
+	Key   string     `json:"key"`
+	Ply   int        `json:"ply"`
+	Moves []BookMove `json:"moves"`
+}
+
+type bookFile struct {
+	Version   int            `json:"version"`
+	Variant   string         `json:"variant"`
+	Depth     int            `json:"depth"`
+	Positions []bookPosition `json:"positions"`
+}
+
+// Book holds opening moves for classic geometry games of one variant.
+type Book struct {
+	Variant   string
+	Depth     int // the search depth the moves were picked with
+	positions map[uint64]bookPosition
+}
+
+func LoadBook(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBook(f)
+}
+
+func ReadBook(r io.Reader) (*Book, error) {
+	var file bookFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.Version != bookVersion {
+		return nil, fmt.Errorf("unsupported book version %d", file.Version)
+	}
+	book := &Book{Variant: file.Variant, Depth: file.Depth, positions: make(map[uint64]bookPosition, len(file.Positions))}
+	for _, position := range file.Positions {
+		key, err := strconv.ParseUint(position.Key, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid book key %q", position.Key)
+		}
+		book.positions[key] = position
+	}
+	return book, nil
+}
+
+func (this *Book) Write(w io.Writer) error {
+	file := bookFile{Version: bookVersion, Variant: this.Variant, Depth: this.Depth}
+	for key, position := range this.positions {
+		position.Key = fmt.Sprintf("%016x", key)
+		file.Positions = append(file.Positions, position)
+	}
+	// Shallow positions first, and a stable order so regenerated books diff cleanly.
+	slices.SortFunc(file.Positions, func(a, b bookPosition) int {
+		if a.Ply != b.Ply {
+			return a.Ply - b.Ply
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(file)
+}
+
+func (this *Book) Len() int {
+	return len(this.positions)
+}
+
+// Moves returns the book moves for state, if the book has its position.
+func (this *Book) Moves(state State) []BookMove {
+	pos, ok := NewPosition(state)
+	if !ok {
+		return nil
+	}
+	return this.positions[pos.hash].Moves
+}
+
+// Pick chooses one of state's book moves at random, weighted; it fails when the book doesn't
+// have the position.
+func (this *Book) Pick(state State, rng *rand.Rand) (Move, bool) {
+	var moves []BookMove
+	total := 0
+	for _, candidate := range this.Moves(state) {
+		// The key is a hash: check the move really is legal here.
+		candidate.Move.Player = state.ToMove
+		if _, err := PerformMove(state, candidate.Move); err != nil || candidate.Weight <= 0 {
+			continue
+		}
+		moves = append(moves, candidate)
+		total += candidate.Weight
+	}
+	if total == 0 {
+		return Move{}, false
+	}
+	pick := rng.Intn(total)
+	for _, candidate := range moves {
+		if pick < candidate.Weight {
+			return candidate.Move, true
+		}
+		pick -= candidate.Weight
+	}
+	return Move{}, false
+}
+
+// BookOptions controls GenerateBook.
+type BookOptions struct {
+	Variant string
+	Plies   int // positions up to this many plies from the start get book moves
+	Depth   int // the search depth moves are scored at
+	Width   int // the most moves kept per position
+	// Margin is how far below the best score a move may be and still be kept; a move's weight is
+	// one more than the margin it leaves.
+	Margin int
+	// Seed shuffles equally scored moves (symmetric ones, say) before Width cuts them off.
+	Seed    int64
+	Weights Weights
+}
+
+// GenerateBook scores every move of the start position with a fixed-depth search, keeps the good
+// ones, and does the same for the positions they lead to, breadth first, up to options.Plies.
+// progress, if not nil, is called after each position.
+func GenerateBook(ctx context.Context, options BookOptions, progress func(ply int, positions int)) (*Book, error) {
+	rules := ClassicRules
+	rules.Variant = options.Variant
+	book := &Book{Variant: options.Variant, Depth: options.Depth, positions: map[uint64]bookPosition{}}
+	tt := newTranspositionTable(ttEntries)
+	rng := rand.New(rand.NewSource(options.Seed))
+
+	start, _ := NewPosition(NewState(rules))
+	frontier := []Position{start}
+	for ply := 0; ply < options.Plies; ply++ {
+		var next []Position
+		for _, pos := range frontier {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if _, ok := book.positions[pos.hash]; ok || pos.winner != None {
+				continue
+			}
+			moves := scoreBookMoves(ctx, pos, tt, rng, options)
+			if len(moves) == 0 {
+				continue
+			}
+			position := bookPosition{Ply: ply}
+			for _, m := range moves {
+				position.Moves = append(position.Moves, BookMove{Move: pos.Move(m.move), Weight: m.score})
+				child := pos
+				child.Make(m.move)
+				next = append(next, child)
+			}
+			book.positions[pos.hash] = position
+			if progress != nil {
+				progress(ply, len(book.positions))
+			}
+		}
+		frontier = next
+	}
+	return book, nil
+}
+
+// scoreBookMoves returns the moves of pos kept for the book, best first, with their weights as
+// scores.
+func scoreBookMoves(ctx context.Context, pos Position, tt *transpositionTable, rng *rand.Rand, options BookOptions) []bitChild {
+	search := newPositionSearch(ctx, pos, tt, &options.Weights)
+	var children []bitChild
+	for _, m := range pos.Moves(nil) {
+		search.pos.Make(m)
+		score := -search.alphaBeta(options.Depth-1, -abInf, abInf, 1)
+		search.pos.Unmake()
+		children = append(children, bitChild{move: m, score: score})
+	}
+	if search.stopped || len(children) == 0 {
+		return nil
+	}
+	rng.Shuffle(len(children), func(i, j int) { children[i], children[j] = children[j], children[i] })
+	slices.SortStableFunc(children, func(a, b bitChild) int { return b.score - a.score })
+	best := children[0].score
+	kept := children[:0]
+	for _, child := range children {
+		if len(kept) == options.Width || best-child.score > options.Margin {
+			break
+		}
+		child.score = options.Margin + 1 - (best - child.score)
+		kept = append(kept, child)
+	}
+	return kept
+}
+
+// bookEngine plays from a book while it has the position, and searches with engine after.
+type bookEngine struct {
+	book   *Book
+	engine Engine
+	rng    *rand.Rand
+}
+
+// WithBook makes engine consult book first.
+func WithBook(engine Engine, book *Book, seed int64) Engine {
+	return &bookEngine{book: book, engine: engine, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (this *bookEngine) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	if state.Winner == None && state.Rules.Variant == this.book.Variant {
+		if move, ok := this.book.Pick(state, this.rng); ok {
+			move.Player = state.ToMove
+			return move, Info{Book: true}
+		}
+	}
+	return this.engine.Search(ctx, state, limits)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// fixedEngine always plays move, so tests can tell its moves from the book's.
+type fixedEngine struct {
+	move Move
+}
+
+func (this fixedEngine) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	return this.move, Info{}
+}
+
+// bookWith writes a book file with moves for the position of state.
+func bookWith(t *testing.T, state State, moves ...BookMove) *Book {
+	t.Helper()
+	pos, _ := NewPosition(state)
+	file := bookFile{Version: bookVersion, Variant: state.Rules.Variant, Depth: 4, Positions: []bookPosition{
+		{Key: fmt.Sprintf("%016x", pos.hash), Moves: moves},
+	}}
+	text, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := ReadBook(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func TestBookMove(t *testing.T) {
+	state := playNotation(t, ClassicRules, "e5")
+	want, _ := ParseMoveNotation(ClassicRules, "e4", Circle)
+	// An illegal move and a move without weight are never picked.
+	illegal, _ := ParseMoveNotation(ClassicRules, "a1", Circle)
+	other, _ := ParseMoveNotation(ClassicRules, "e6", Circle)
+	book := bookWith(t, state, BookMove{Move: illegal, Weight: 5}, BookMove{Move: want, Weight: 1}, BookMove{Move: other})
+
+	searched := fixedEngine{move: other}
+	engine := WithBook(searched, book, 1)
+	for range 10 {
+		move, info := engine.Search(context.Background(), state, Limits{})
+		if move != want || !info.Book {
+			t.Fatalf("played %s (book %v), want the book move e4", MoveNotation(ClassicRules, move), info.Book)
+		}
+	}
+
+	// Positions the book doesn't have, or games of another variant, are searched.
+	if _, info := engine.Search(context.Background(), playNotation(t, ClassicRules, "e5 e4"), Limits{}); info.Book {
+		t.Fatal("played a book move in a position not in the book")
+	}
+	misere := ClassicRules
+	misere.Variant = VariantMisere
+	if _, info := engine.Search(context.Background(), playNotation(t, misere, "e5"), Limits{}); info.Book {
+		t.Fatal("played a book move in another variant")
+	}
+}
+
+func TestBookRoundTrip(t *testing.T) {
+	book, err := GenerateBook(context.Background(), BookOptions{Variant: VariantStandard, Plies: 2, Depth: 2, Width: 2, Margin: 50, Seed: 1, Weights: DefaultWeights}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	if err := book.Write(&text); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBook(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Len() != book.Len() || read.Len() < 2 {
+		t.Fatalf("read %d positions, wrote %d", read.Len(), book.Len())
+	}
+	start := NewState(ClassicRules)
+	if move, ok := read.Pick(start, rand.New(rand.NewSource(1))); !ok {
+		t.Fatal("no book move at the start")
+	} else if _, err := PerformMove(start, move); err != nil {
+		t.Fatalf("book move %+v: %v", move, err)
+	}
+}
+
+func TestReadBookErrors(t *testing.T) {
+	for _, text := range []string{
+		`{"version":2,"positions":[]}`,
+		`{"version":1,"positions":[{"key":"not hex","moves":[]}]}`,
+		`{"version":1,`,
+	} {
+		if _, err := ReadBook(strings.NewReader(text)); err == nil {
+			t.Errorf("read %s", text)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// runCommand handles the command-line tools that run instead of the bot.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "book":
+		return bookCommand(args[1:])
+	case "arena":
+		return arenaCommand(args[1:])
+	case "tune":
+		return tuneCommand(args[1:])
+	case "bench":
+		return benchCommand(args[1:])
+	case "perft":
+		return perftCommand(args[1:])
+	case "uci":
+		// Settings come from the environment as for the bot, and from setoption.
+		return runProtocol(os.Stdin, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// bookCommand generates an opening book and writes it to a file.
+func bookCommand(args []string) error {
+	flags := flag.NewFlagSet("book", flag.ContinueOnError)
+	out := flags.String("out", "book.json", "file to write the book to")
+	options := BookOptions{Weights: DefaultWeights}
+	flags.StringVar(&options.Variant, "variant", VariantStandard, "rules variant the book is for")
+	flags.IntVar(&options.Plies, "plies", 4, "plies from the start covered by the book")
+	flags.IntVar(&options.Depth, "depth", 9, "search depth moves are scored at")
+	flags.IntVar(&options.Width, "width", 3, "most moves kept per position")
+	flags.IntVar(&options.Margin, "margin", 2, "how far below the best score kept moves may be")
+	flags.Int64Var(&options.Seed, "seed", 1, "seed for ordering equally scored moves")
+	weightsFile := flags.String("weights", "", "evaluation weights file (default: the built-in weights)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *weightsFile != "" {
+		weights, err := LoadWeights(*weightsFile)
+		if err != nil {
+			return err
+		}
+		options.Weights = weights
+	}
+	rules := ClassicRules
+	rules.Variant = options.Variant
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if options.Plies < 1 || options.Depth < 1 || options.Width < 1 || options.Margin < 0 {
+		return fmt.Errorf("plies, depth and width must be positive and margin not negative")
+	}
+
+	book, err := GenerateBook(context.Background(), options, func(ply int, positions int) {
+		fmt.Printf("ply=%d positions=%d\n", ply, positions)
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := book.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: positions=%d\n", *out, book.Len())
+	return nil
+}
+
+// arenaCommand plays two bot configurations against each other and reports the result.
+func arenaCommand(args []string) error {
+	flags := flag.NewFlagSet("arena", flag.ContinueOnError)
+	specA := flags.String("a", "engine=alphabeta", "first configuration: settings named like the BOT_ variables, \"engine=mcts,mcts_playout=random\" say")
+	specB := flags.String("b", "engine=alphabeta", "second configuration, like -a")
+	variant := flags.String("variant", VariantStandard, "rules variant")
+	options := ArenaOptions{}
+	flags.IntVar(&options.Games, "games", 100, "most games to play")
+	flags.IntVar(&options.Concurrency, "concurrency", runtime.NumCPU(), "games played at once")
+	flags.DurationVar(&options.MoveTime, "movetime", 100*time.Millisecond, "thinking time per move")
+	flags.IntVar(&options.Depth, "depth", 0, "deepest search iteration (0: as deep as -movetime allows)")
+	flags.IntVar(&options.OpeningPlies, "openings", 2, "random moves each pair of games starts with")
+	flags.Int64Var(&options.Seed, "seed", 1, "seed for openings and engines")
+	sprt := SPRT{}
+	useSPRT := flags.Bool("sprt", false, "stop once a sequential probability ratio test decides")
+	flags.Float64Var(&sprt.Elo0, "elo0", 0, "SPRT: Elo difference of H0")
+	flags.Float64Var(&sprt.Elo1, "elo1", 20, "SPRT: Elo difference of H1")
+	flags.Float64Var(&sprt.Alpha, "alpha", 0.05, "SPRT: false positive rate")
+	flags.Float64Var(&sprt.Beta, "beta", 0.05, "SPRT: false negative rate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	a, err := configFromSpec(*specA)
+	if err != nil {
+		return fmt.Errorf("-a: %v", err)
+	}
+	b, err := configFromSpec(*specB)
+	if err != nil {
+		return fmt.Errorf("-b: %v", err)
+	}
+	options.Rules = ClassicRules
+	options.Rules.Variant = *variant
+	if err := options.Rules.Validate(); err != nil {
+		return err
+	}
+	if options.Games < 1 || options.MoveTime <= 0 || options.OpeningPlies < 0 {
+		return fmt.Errorf("games and movetime must be positive and openings not negative")
+	}
+	if *useSPRT {
+		if sprt.Elo1 <= sprt.Elo0 || sprt.Alpha <= 0 || sprt.Alpha >= 1 || sprt.Beta <= 0 || sprt.Beta >= 1 {
+			return fmt.Errorf("the SPRT needs elo0 < elo1 and error rates between 0 and 1")
+		}
+		options.SPRT = &sprt
+	}
+
+	result, err := RunArena(context.Background(), a, b, options, func(result ArenaResult) {
+		line := result.String()
+		if options.SPRT != nil {
+			lower, upper := options.SPRT.Bounds()
+			line += fmt.Sprintf(" llr=%.2f [%.2f, %.2f]", options.SPRT.LLR(result), lower, upper)
+		}
+		fmt.Println(line)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("a=%q b=%q %s", *specA, *specB, result)
+	if result.Decision != "" {
+		fmt.Printf(" sprt=%s", result.Decision)
+	}
+	fmt.Println()
+	return nil
+}
+
+// tuneCommand fits the evaluation weights to self-play games and writes them to a file.
+func tuneCommand(args []string) error {
+	flags := flag.NewFlagSet("tune", flag.ContinueOnError)
+	out := flags.String("out", "weights.json", "file to write the tuned weights to")
+	from := flags.String("weights", "", "weights to play the games with and start from (default: the built-in weights)")
+	options := TuneOptions{Weights: DefaultWeights}
+	flags.StringVar(&options.Variant, "variant", VariantStandard, "rules variant to tune for")
+	flags.IntVar(&options.Games, "games", 200, "self-play games to take positions from")
+	flags.IntVar(&options.Depth, "depth", 4, "search depth of the self-play moves")
+	flags.IntVar(&options.OpeningPlies, "openings", 4, "random moves each game starts with")
+	flags.IntVar(&options.Epochs, "epochs", 2000, "gradient descent steps")
+	flags.Float64Var(&options.Rate, "rate", 0.05, "gradient descent step size, in weight units")
+	flags.IntVar(&options.Concurrency, "concurrency", runtime.NumCPU(), "games played at once")
+	flags.Int64Var(&options.Seed, "seed", 1, "seed for the openings")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from != "" {
+		weights, err := LoadWeights(*from)
+		if err != nil {
+			return err
+		}
+		options.Weights = weights
+	}
+	rules := ClassicRules
+	rules.Variant = options.Variant
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if options.Games < 1 || options.Depth < 1 || options.Epochs < 1 || options.Rate <= 0 || options.OpeningPlies < 0 {
+		return fmt.Errorf("games, depth, epochs and rate must be positive and openings not negative")
+	}
+
+	result, err := Tune(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result.Weights, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: positions=%d k=%.4f error=%.5f->%.5f\n", *out, result.Positions, result.K, result.ErrorBefore, result.ErrorAfter)
+	return nil
+}
+
+// perftCommand counts the positions at each depth from a position, with both move generators for
+// classic games, and fails if they disagree.
+func perftCommand(args []string) error {
+	flags := flag.NewFlagSet("perft", flag.ContinueOnError)
+	depth := flags.Int("depth", 4, "plies to count to")
+	divide := flags.Bool("divide", false, "also count the positions under each first move at -depth")
+	rules := ClassicRules
+	flags.StringVar(&rules.Variant, "variant", VariantStandard, "rules variant")
+	flags.IntVar(&rules.Size, "size", ClassicRules.Size, "board size")
+	flags.IntVar(&rules.Line, "line", ClassicRules.Line, "marks in a row that win a board")
+	flags.IntVar(&rules.Depth, "levels", ClassicRules.Depth, "levels of nested boards")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: perft [flags] [move...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	if *depth < 1 {
+		return fmt.Errorf("depth must be positive")
+	}
+	state := NewState(rules)
+	for _, text := range flags.Args() {
+		move, err := ParseMoveNotation(rules, text, state.ToMove)
+		if err != nil {
+			return err
+		}
+		if state, err = PerformMove(state, move); err != nil {
+			return fmt.Errorf("move %s: %v", text, err)
+		}
+	}
+
+	pos, classic := NewPosition(state)
+	for d := 1; d <= *depth; d++ {
+		start := time.Now()
+		nodes := Perft(state, d)
+		elapsed := time.Since(start)
+		line := fmt.Sprintf("depth=%d nodes=%d time=%s nps=%.0f", d, nodes, elapsed.Round(time.Millisecond), float64(nodes)/elapsed.Seconds())
+		if classic {
+			start = time.Now()
+			bitNodes := pos.perft(d)
+			line += fmt.Sprintf(" bitboard_time=%s", time.Since(start).Round(time.Millisecond))
+			if bitNodes != nodes {
+				fmt.Println(line)
+				return fmt.Errorf("the bitboard generator counts %d nodes at depth %d", bitNodes, d)
+			}
+		}
+		fmt.Println(line)
+	}
+	if *divide {
+		moves, counts := PerftDivide(state, *depth)
+		for i, move := range moves {
+			fmt.Printf("%s %d\n", MoveNotation(rules, move), counts[i])
+		}
+	}
+	return nil
+}
+
+// benchCommand searches the benchmark positions to a fixed depth and reports the nodes, speed and
+// chosen move of each. With -nodes it fails if the total node count isn't the expected one, a
+// quick check that a change left the search alone.
+func benchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	depth := flags.Int("depth", benchDepth, "search depth")
+	expect := flags.Int("nodes", 0, "total node count to expect (0: don't check)")
+	weightsFile := flags.String("weights", "", "evaluation weights file (default: the built-in weights)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *depth < 1 {
+		return fmt.Errorf("depth must be positive")
+	}
+	weights := DefaultWeights
+	if *weightsFile != "" {
+		var err error
+		if weights, err = LoadWeights(*weightsFile); err != nil {
+			return err
+		}
+	}
+
+	nodes, elapsed, err := RunBench(*depth, &weights, func(result BenchResult) {
+		fmt.Println(result)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("total depth=%d nodes=%d time=%s nps=%.0f\n", *depth, nodes, elapsed.Round(time.Millisecond), float64(nodes)/elapsed.Seconds())
+	if *expect != 0 && nodes != *expect {
+		return fmt.Errorf("expected %d nodes, searched %d", *expect, nodes)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// botConfig is read from the environment:
+//
+//	BOT_ENGINE            a registered engine: alphabeta (default), mcts or random
+//	BOT_THREADS           goroutines per alphabeta search (default 1)
+//	BOT_SOLVE_THRESHOLD   empty playable cells at which alphabeta starts solving (default 24, -1 never)
+//	BOT_MCTS_ITERATIONS   playouts per move for mcts; 0 (default) uses the whole time budget
+//	BOT_MCTS_PLAYOUT      heuristic (default) or random
+//	BOT_BOOK              an opening book file (see the book command) to play from first
+//	BOT_WEIGHTS           a JSON file of evaluation weights by feature name (see weights.go)
+//	BOT_LEVEL             the difficulty level of matchmade games (default max, see level.go); games
+//	                      players start against the bot bring their own
+type botConfig struct {
+	Engine         string
+	Threads        int
+	SolveThreshold int
+	MCTSIterations int
+	MCTSPlayout    string
+	Book           *Book
+	Weights        Weights
+	Level          Level
+}
+
+var configVariables = []string{
+	"BOT_ENGINE", "BOT_THREADS", "BOT_SOLVE_THRESHOLD", "BOT_MCTS_ITERATIONS", "BOT_MCTS_PLAYOUT", "BOT_BOOK", "BOT_WEIGHTS", "BOT_LEVEL",
+}
+
+func loadConfig() (botConfig, error) {
+	return configFrom(os.Getenv)
+}
+
+// configFrom reads a botConfig from the variables getenv returns, as loadConfig does from the
+// environment.
+func configFrom(getenv func(string) string) (botConfig, error) {
+	config := botConfig{Engine: EngineAlphaBeta, Threads: 1, MCTSPlayout: PlayoutHeuristic, Weights: DefaultWeights}
+	config.Level, _ = LevelByName(LevelMax)
+	if engine := getenv("BOT_ENGINE"); engine != "" {
+		config.Engine = engine
+	}
+	if _, ok := engineFactories[config.Engine]; !ok {
+		return config, fmt.Errorf("unknown BOT_ENGINE %q (known: %v)", config.Engine, EngineNames())
+	}
+	if threads := getenv("BOT_THREADS"); threads != "" {
+		n, err := strconv.Atoi(threads)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("invalid BOT_THREADS %q", threads)
+		}
+		config.Threads = n
+	}
+	if threshold := getenv("BOT_SOLVE_THRESHOLD"); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < -1 {
+			return config, fmt.Errorf("invalid BOT_SOLVE_THRESHOLD %q", threshold)
+		}
+		config.SolveThreshold = n
+	}
+	if iterations := getenv("BOT_MCTS_ITERATIONS"); iterations != "" {
+		n, err := strconv.Atoi(iterations)
+		if err != nil || n < 0 {
+			return config, fmt.Errorf("invalid BOT_MCTS_ITERATIONS %q", iterations)
+		}
+		config.MCTSIterations = n
+	}
+	if playout := getenv("BOT_MCTS_PLAYOUT"); playout != "" {
+		config.MCTSPlayout = playout
+	}
+	if config.MCTSPlayout != PlayoutRandom && config.MCTSPlayout != PlayoutHeuristic {
+		return config, fmt.Errorf("unknown BOT_MCTS_PLAYOUT %q", config.MCTSPlayout)
+	}
+	if name := getenv("BOT_LEVEL"); name != "" {
+		level, ok := LevelByName(name)
+		if !ok {
+			return config, fmt.Errorf("unknown BOT_LEVEL %q (known: %v)", name, LevelNames())
+		}
+		config.Level = level
+	}
+	if path := getenv("BOT_WEIGHTS"); path != "" {
+		weights, err := LoadWeights(path)
+		if err != nil {
+			return config, fmt.Errorf("loading BOT_WEIGHTS: %v", err)
+		}
+		config.Weights = weights
+	}
+	if path := getenv("BOT_BOOK"); path != "" {
+		book, err := LoadBook(path)
+		if err != nil {
+			return config, fmt.Errorf("loading BOT_BOOK: %v", err)
+		}
+		config.Book = book
+	}
+	return config, nil
+}
+
+// configFromSpec reads a botConfig from a comma-separated list of settings named like the
+// environment variables without the BOT_ prefix, "engine=mcts,mcts_playout=random" say.
+func configFromSpec(spec string) (botConfig, error) {
+	settings := map[string]string{}
+	for _, setting := range strings.Split(spec, ",") {
+		if setting == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return botConfig{}, fmt.Errorf("invalid setting %q", setting)
+		}
+		settings[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return configFromSettings(settings)
+}
+
+// configFromSettings reads a botConfig from settings named like the environment variables without
+// the BOT_ prefix, in any case.
+func configFromSettings(settings map[string]string) (botConfig, error) {
+	variables := map[string]string{}
+	for name, value := range settings {
+		variable, ok := settingVariable(name)
+		if !ok {
+			return botConfig{}, fmt.Errorf("unknown setting %q", name)
+		}
+		variables[variable] = value
+	}
+	return configFrom(func(variable string) string { return variables[variable] })
+}
+
+// settingVariable returns the environment variable of a setting.
+func settingVariable(name string) (string, bool) {
+	variable := "BOT_" + strings.ToUpper(name)
+	return variable, slices.Contains(configVariables, variable)
+}
+
+// newEngine returns the engine a game is played with, at the configured level; each game gets its
+// own, since engines may keep state from one move to the next. Its searches use tt, or the shared
+// table if tt is nil.
+func (this botConfig) newEngine(seed int64, tt *transpositionTable) Engine {
+	engine, _ := NewEngine(this.Engine, EngineOptions{
+		Seed:           seed,
+		Threads:        this.Threads,
+		SolveThreshold: this.SolveThreshold,
+		Weights:        &this.Weights,
+		Playout:        this.MCTSPlayout,
+		TT:             tt,
+	})
+	if this.Book != nil {
+		engine = WithBook(engine, this.Book, seed)
+	}
+	return WithLevel(engine, this.Level, &this.Weights, tt, seed)
+}
+
+// limits returns the search limits of a move with the given thinking time.
+func (this botConfig) limits(budget time.Duration) Limits {
+	return Limits{Depth: maxSearchDepth, Iterations: this.MCTSIterations, Time: budget}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Limits bound a search; zero fields don't limit it. A search also stops when its ctx is done.
+type Limits struct {
+	Depth      int           // deepest iteration of a depth-first search
+	Iterations int           // playouts of a Monte Carlo search
+	Time       time.Duration // thinking time
+	// Infinite lets a search run without any of the limits above, until ctx is done; engines
+	// refuse unbounded searches without it.
+	Infinite bool
+	// OnIteration, if not nil, is called by depth-first searches after each depth they complete.
+	OnIteration func(Info)
+}
+
+// Info reports on a search. Fields an engine doesn't track are left zero.
+type Info struct {
+	Depth      int // the last depth searched to completion, or the length of the most visited line
+	Score      int // from the mover's perspective, in the engine's own units
+	Nodes      int
+	Iterations int
+	TTProbes   int
+	TTHits     int
+	Time       time.Duration
+	// Proven is set when the endgame solver proved Outcome; Distance counts the plies to a won or
+	// lost end.
+	Proven   bool
+	Outcome  Outcome
+	Distance int
+	// Book is set when the move came from the opening book rather than a search.
+	Book bool
+	// PV is the principal variation, when the engine reports one: the moves best play continues
+	// with, starting with the move to play.
+	PV []Move
+}
+
+// TTHitRate is the share of transposition table probes that found an entry, in percent.
+func (this Info) TTHitRate() float64 {
+	if this.TTProbes == 0 {
+		return 0
+	}
+	return 100 * float64(this.TTHits) / float64(this.TTProbes)
+}
+
+// Proof describes a proven result, or returns "-".
+func (this Info) Proof() string {
+	if !this.Proven {
+		return "-"
+	}
+	if this.Outcome == OutcomeDraw {
+		return this.Outcome.String()
+	}
+	return fmt.Sprintf("%s in %d", this.Outcome, this.Distance)
+}
+
+// NoMove is what engines return when there is no legal move.
+var NoMove = Move{Player: None}
+
+// Engine picks moves. Search returns a move for state.ToMove, or NoMove when state has no legal
+// move. Engines may keep state between searches (the MCTS tree, say), so each game should get
+// its own.
+type Engine interface {
+	Search(ctx context.Context, state State, limits Limits) (Move, Info)
+}
+
+// EngineOptions configures a new engine; each engine uses the options that apply to it.
+type EngineOptions struct {
+	Seed    int64
+	Threads int // for alphabeta: the goroutines a search uses; 0 means 1
+	// SolveThreshold is, for alphabeta, the number of empty cells on playable boards below which
+	// the engine tries to solve positions exactly; 0 means defaultSolveThreshold, -1 never.
+	SolveThreshold int
+	Weights        *Weights // for alphabeta: the evaluation weights; nil means DefaultWeights
+	Playout        string   // for mcts: PlayoutRandom or PlayoutHeuristic
+	// TT is, for alphabeta, the transposition table searches use; nil means sharedTT.
+	TT *transpositionTable
+}
+
+type EngineFactory func(options EngineOptions) Engine
+
+var engineFactories = map[string]EngineFactory{}
+
+// RegisterEngine makes an engine available to NewEngine under name.
+func RegisterEngine(name string, factory EngineFactory) {
+	engineFactories[name] = factory
+}
+
+func NewEngine(name string, options EngineOptions) (Engine, error) {
+	factory, ok := engineFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q (known: %v)", name, EngineNames())
+	}
+	return factory(options), nil
+}
+
+func EngineNames() []string {
+	names := make([]string, 0, len(engineFactories))
+	for name := range engineFactories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+const (
+	EngineAlphaBeta = "alphabeta"
+	EngineMCTS      = "mcts"
+	EngineRandom    = "random"
+)
+
+func init() {
+	RegisterEngine(EngineAlphaBeta, func(options EngineOptions) Engine {
+		threshold := options.SolveThreshold
+		if threshold == 0 {
+			threshold = defaultSolveThreshold
+		}
+		weights := options.Weights
+		if weights == nil {
+			weights = &DefaultWeights
+		}
+		tt := options.TT
+		if tt == nil {
+			tt = sharedTT()
+		}
+		return alphaBetaEngine{threads: max(options.Threads, 1), solveThreshold: threshold, weights: weights, tt: tt}
+	})
+	RegisterEngine(EngineMCTS, func(options EngineOptions) Engine { return NewMCTS(options.Playout, options.Seed) })
+	RegisterEngine(EngineRandom, func(options EngineOptions) Engine {
+		return &randomEngine{rng: rand.New(rand.NewSource(options.Seed))}
+	})
+}
+
+// withLimit applies limits.Time to ctx.
+func withLimit(ctx context.Context, limits Limits) (context.Context, context.CancelFunc) {
+	if limits.Time > 0 {
+		return context.WithTimeout(ctx, limits.Time)
+	}
+	return context.WithCancel(ctx)
+}
+
+// withFraction limits ctx to 1/divisor of the time it has left, if it has a deadline.
+func withFraction(ctx context.Context, divisor int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(divisor))
+}
+
+// alphaBetaEngine is the iterative deepening alpha-beta search, which gives late positions to
+// the endgame solver first.
+type alphaBetaEngine struct {
+	threads        int
+	solveThreshold int
+	weights        *Weights
+	tt             *transpositionTable
+}
+
+func (this alphaBetaEngine) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	ctx, cancel := withLimit(ctx, limits)
+	defer cancel()
+	depth := limits.Depth
+	if depth == 0 {
+		depth = maxPly
+	}
+	if state.Winner != None {
+		return NoMove, Info{}
+	}
+	start := time.Now()
+	if this.solvable(state) {
+		// The solver gets half the time; if it can't finish, the search gets the rest.
+		solveCtx, cancel := withFraction(ctx, 2)
+		move, info, ok := solve(solveCtx, state, this.tt)
+		cancel()
+		if ok {
+			info.Time = time.Since(start)
+			return move, info
+		}
+	}
+	move, info, ok := bestMoveIterative(ctx, state, depth, this.threads, this.tt, this.weights, limits.OnIteration)
+	info.Time = time.Since(start)
+	if !ok {
+		return NoMove, info
+	}
+	move.Player = state.ToMove
+	return move, info
+}
+
+func (this alphaBetaEngine) solvable(state State) bool {
+	if this.solveThreshold < 0 {
+		return false
+	}
+	pos, ok := NewPosition(state)
+	return ok && pos.openCells() <= this.solveThreshold
+}
+
+// randomEngine plays a uniformly random legal move.
+type randomEngine struct {
+	rng *rand.Rand
+}
+
+func (this *randomEngine) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	if state.Winner != None {
+		return NoMove, Info{}
+	}
+	moves := LegalMoves(state)
+	if len(moves) == 0 {
+		return NoMove, Info{}
+	}
+	return moves[this.rng.Intn(len(moves))], Info{Nodes: 1}
+}
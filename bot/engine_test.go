@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewEngine(t *testing.T) {
+	if engine, err := NewEngine("stockfish", EngineOptions{}); err == nil {
+		t.Fatalf("made an engine %T for an unknown name", engine)
+	}
+
+	state := playNotation(t, ClassicRules, "e5 e4")
+	for _, name := range EngineNames() {
+		t.Run(name, func(t *testing.T) {
+			engine, err := NewEngine(name, EngineOptions{Seed: 1, TT: newTranspositionTable(1 << 16)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			move, _ := engine.Search(context.Background(), state, Limits{Depth: 3, Iterations: 200, Time: time.Second})
+			if _, err := PerformMove(state, move); err != nil {
+				t.Fatalf("move %+v: %v", move, err)
+			}
+		})
+	}
+}
+
+func TestConfigEngine(t *testing.T) {
+	tests := []struct {
+		spec  string
+		fails bool
+	}{
+		{"", false},
+		{"engine=mcts,mcts_playout=random", false},
+		{"engine=stockfish", true},
+		{"engine=mcts,mcts_playout=smart", true},
+		{"threads=0", true},
+		{"depth=4", true},
+		{"engine", true},
+	}
+	for _, test := range tests {
+		if config, err := configFromSpec(test.spec); (err != nil) != test.fails {
+			t.Errorf("%q: config %+v, error %v", test.spec, config, err)
+		}
+	}
+}
@@ -2,67 +2,38 @@ package main
 
 import (
 	"context"
+	"slices"
 	"sort"
 )
 
-func localHasEmpty(local LocalState) bool {
-	for x := range 3 {
-		for y := range 3 {
-			if local.Values[x][y] == None {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-func localPlayable(local LocalState) bool {
-	return local.Winner == None && localHasEmpty(local)
-}
-
-// LegalMoves generates all legal moves for state.ToMove.
+// LegalMoves generates all legal moves for state.ToMove: none once the game is won, as PerformMove
+// refuses them.
 func LegalMoves(state State) []Move {
+	rules := state.Rules
 	moves := make([]Move, 0, 81)
 	player := state.ToMove
+	if state.Winner != None {
+		return moves
+	}
 
-	// Determine which local boards are allowed (forced location unless that board is not playable).
-	allowed := make([][2]int, 0, 9)
-	if state.Location != -1 {
-		cx, cy := state.Location/3, state.Location%3
-		if localPlayable(state.Values[cx][cy]) {
-			allowed = append(allowed, [2]int{cx, cy})
-		} else {
-			for i := range 3 {
-				for j := range 3 {
-					if localPlayable(state.Values[i][j]) {
-						allowed = append(allowed, [2]int{i, j})
-					}
-				}
-			}
-		}
+	// Determine which bottom-level boards are allowed (forced location unless that board is not playable).
+	allowed := make([]int, 0, rules.BoardCount())
+	if state.Location != -1 && state.Playable(state.Location) {
+		allowed = append(allowed, state.Location)
 	} else {
-		for i := range 3 {
-			for j := range 3 {
-				if localPlayable(state.Values[i][j]) {
-					allowed = append(allowed, [2]int{i, j})
-				}
+		for board := range rules.BoardCount() {
+			if state.Playable(board) {
+				allowed = append(allowed, board)
 			}
 		}
 	}
 
-	for _, cell := range allowed {
-		cx, cy := cell[0], cell[1]
-		local := state.Values[cx][cy]
-		for fx := range 3 {
-			for fy := range 3 {
+	for _, board := range allowed {
+		local, _ := state.Board(board)
+		for fx := range rules.Size {
+			for fy := range rules.Size {
 				if local.Values[fx][fy] == None {
-					moves = append(moves, Move{
-						Player: player,
-						CellX:  cx,
-						CellY:  cy,
-						FinalX: fx,
-						FinalY: fy,
-					})
+					moves = append(moves, MoveAt(rules, player, board, fx, fy))
 				}
 			}
 		}
@@ -184,6 +155,10 @@ func alphaBetaPlyCtx(ctx context.Context, state State, depth int, alpha int, bet
 
 // BestMove returns the best move for state.ToMove using alpha-beta search.
 func BestMove(state State, depth int) (Move, bool) {
+	if pos, ok := NewPosition(state); ok {
+		move, _, ok := newPositionSearch(context.Background(), pos, sharedTT(), &DefaultWeights).bestMove(depth)
+		return move, ok
+	}
 	moves := LegalMoves(state)
 	if len(moves) == 0 {
 		return Move{}, false
@@ -211,6 +186,10 @@ func BestMove(state State, depth int) (Move, bool) {
 
 // BestMoveCtx is a cancellation/time-bounded variant. It returns the best move found so far if ctx is cancelled.
 func BestMoveCtx(ctx context.Context, state State, depth int) (Move, bool) {
+	if pos, ok := NewPosition(state); ok {
+		move, _, ok := newPositionSearch(ctx, pos, sharedTT(), &DefaultWeights).bestMove(depth)
+		return move, ok
+	}
 	moves := LegalMoves(state)
 	if len(moves) == 0 {
 		return Move{}, false
@@ -245,6 +224,277 @@ func BestMoveCtx(ctx context.Context, state State, depth int) (Move, bool) {
 	return bestMove, true
 }
 
+type bitChild struct {
+	move  bitMove
+	score int
+}
+
+// noMove marks a table entry without a best move; real moves are below 81.
+const noMove bitMove = 0xff
+
+// Move ordering: the table's best move, then the moves winning a local board, the moves blocking
+// the opponent from winning one and the killer moves, and the other (quiet) moves by their
+// history score, which stays below the killers.
+const (
+	orderTTMove   = 1 << 30
+	orderWinning  = 1 << 29
+	orderBlocking = 1 << 28
+	orderKiller   = 1 << 27
+	historyMax    = 1 << 26
+)
+
+// Late move reductions: quiet moves ordered after the first lmrMinMoves are first searched a ply
+// shallower at nodes with at least lmrMinDepth plies left, and fully only if they look good.
+const (
+	lmrMinDepth = 3
+	lmrMinMoves = 3
+)
+
+// positionSearch is the alpha-beta search above on a Position, for classic geometry games. It
+// makes and unmakes moves in place instead of copying States, and is written as negamax (scores
+// are from the side to move's perspective) so that transposition table entries don't depend on
+// who the root player is. It is a principal variation search: after the first move, moves are
+// searched with a null window that only tells whether they are better.
+type positionSearch struct {
+	ctx     context.Context
+	pos     Position
+	tt      *transpositionTable
+	weights *Weights
+	salt    uint64 // keeps apart the table entries of searches with different weights
+	stopped bool   // ctx was cancelled: scores from here on are incomplete and aren't stored
+	// onIteration, if not nil, is called by iterate after each completed depth.
+	onIteration func(Info)
+
+	// killers holds, per ply, the last two quiet moves that caused a beta cutoff there, and
+	// history scores quiet moves per player by the cutoffs they caused, deeper ones counting more.
+	killers [maxPly + 1][2]bitMove
+	history [2][81]int
+
+	nodes, probes, hits, cutoffs int
+}
+
+func newPositionSearch(ctx context.Context, pos Position, tt *transpositionTable, weights *Weights) *positionSearch {
+	search := &positionSearch{ctx: ctx, pos: pos, tt: tt, weights: weights, salt: weights.key()}
+	for ply := range search.killers {
+		search.killers[ply] = [2]bitMove{noMove, noMove}
+	}
+	return search
+}
+
+// key is the position's transposition table key.
+func (this *positionSearch) key() uint64 {
+	return this.pos.hash ^ this.salt
+}
+
+func (this *positionSearch) cancelled() bool {
+	if !this.stopped {
+		select {
+		case <-this.ctx.Done():
+			this.stopped = true
+		default:
+		}
+	}
+	return this.stopped
+}
+
+// orderChildren sorts moves best first for the side to move, without making them.
+func (this *positionSearch) orderChildren(moves []bitMove, children []bitChild, ttMove bitMove, ply int) []bitChild {
+	p := &this.pos
+	me := p.toMove
+	decided := p.won[Cross] | p.won[Circle]
+	for _, m := range moves {
+		b, c := int(m/9), int(m%9)
+		open := decided&(1<<b) == 0
+		score := this.history[me][m]
+		switch {
+		case m == ttMove:
+			score = orderTTMove
+		case open && winTable[p.cells[me][b]|1<<c]:
+			score = orderWinning
+		case open && winTable[p.cells[1-me][b]|1<<c]:
+			score = orderBlocking
+		case m == this.killers[ply][0]:
+			score = orderKiller + 1
+		case m == this.killers[ply][1]:
+			score = orderKiller
+		}
+		children = append(children, bitChild{move: m, score: score})
+	}
+	slices.SortStableFunc(children, func(a, b bitChild) int { return b.score - a.score })
+	return children
+}
+
+// recordCutoff remembers a quiet move that caused a beta cutoff.
+func (this *positionSearch) recordCutoff(m bitMove, depth int, ply int) {
+	if this.killers[ply][0] != m {
+		this.killers[ply][1] = this.killers[ply][0]
+		this.killers[ply][0] = m
+	}
+	history := &this.history[this.pos.toMove]
+	history[m] += depth * depth
+	if history[m] >= historyMax {
+		for i := range history {
+			history[i] /= 2
+		}
+	}
+}
+
+// probe looks the position up, tightening alpha and beta with the stored bound. It returns the
+// stored best move, and whether the stored score can be returned as is.
+func (this *positionSearch) probe(depth int, alpha *int, beta *int, ply int) (bitMove, int, bool) {
+	this.probes++
+	entry, ok := this.tt.probe(this.key())
+	if !ok {
+		return noMove, 0, false
+	}
+	this.hits++
+	if entry.depth < depth {
+		return entry.move, 0, false
+	}
+	score := scoreFromTT(entry.score, ply)
+	switch entry.bound {
+	case boundExact:
+		return entry.move, score, true
+	case boundLower:
+		*alpha = max(*alpha, score)
+	case boundUpper:
+		*beta = min(*beta, score)
+	}
+	return entry.move, score, *alpha >= *beta
+}
+
+func (this *positionSearch) store(depth int, score int, alpha int, beta int, move bitMove, ply int) {
+	if this.stopped {
+		return
+	}
+	b := boundExact
+	if score <= alpha {
+		b = boundUpper
+	} else if score >= beta {
+		b = boundLower
+	}
+	this.tt.store(this.key(), ttEntry{score: scoreToTT(score, ply), depth: depth, bound: b, move: move})
+}
+
+func (this *positionSearch) alphaBeta(depth int, alpha int, beta int, ply int) int {
+	me := this.pos.toMove
+	if this.cancelled() {
+		return this.pos.evaluate(me, this.weights)
+	}
+	this.nodes++
+
+	// Terminal: win/loss with mate distance (prefer fast win / slow loss).
+	if this.pos.winner == me {
+		return abInf - ply
+	}
+	if this.pos.winner == 1-me {
+		return -(abInf - ply)
+	}
+	var moveBuf [maxPly]bitMove
+	moves := this.pos.Moves(moveBuf[:0])
+	// Terminal: no moves and no winner -> draw.
+	if len(moves) == 0 {
+		return 0
+	}
+	// Leaf: heuristic.
+	if depth == 0 {
+		return this.pos.evaluate(me, this.weights)
+	}
+
+	alphaOrig, betaOrig := alpha, beta
+	ttMove, score, done := this.probe(depth, &alpha, &beta, ply)
+	if done {
+		this.cutoffs++
+		return score
+	}
+
+	var childBuf [maxPly]bitChild
+	children := this.orderChildren(moves, childBuf[:0], ttMove, ply)
+	best := -abInf
+	bestMove := children[0].move
+	for i, ch := range children {
+		if this.cancelled() {
+			return this.pos.evaluate(me, this.weights)
+		}
+		quiet := ch.score < orderKiller
+		this.pos.Make(ch.move)
+		var score int
+		if i == 0 {
+			score = -this.alphaBeta(depth-1, -beta, -alpha, ply+1)
+		} else {
+			reduction := 0
+			if quiet && depth >= lmrMinDepth && i >= lmrMinMoves {
+				reduction = 1
+			}
+			score = -this.alphaBeta(depth-1-reduction, -alpha-1, -alpha, ply+1)
+			if score > alpha && reduction > 0 {
+				score = -this.alphaBeta(depth-1, -alpha-1, -alpha, ply+1)
+			}
+			if score > alpha && score < beta {
+				score = -this.alphaBeta(depth-1, -beta, -alpha, ply+1)
+			}
+		}
+		this.pos.Unmake()
+		if score > best {
+			best = score
+			bestMove = ch.move
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			if quiet {
+				this.recordCutoff(ch.move, depth, ply)
+			}
+			break
+		}
+	}
+	this.store(depth, best, alphaOrig, betaOrig, bestMove, ply)
+	return best
+}
+
+// bestMove searches the root and returns the best move with its score. It returns the best
+// move found so far if ctx is cancelled.
+func (this *positionSearch) bestMove(depth int) (Move, int, bool) {
+	var moveBuf [maxPly]bitMove
+	moves := this.pos.Moves(moveBuf[:0])
+	if len(moves) == 0 {
+		return Move{}, 0, false
+	}
+
+	// Order root moves for better early pruning and better "best so far" when time runs out.
+	ttMove := noMove
+	if entry, ok := this.tt.probe(this.key()); ok {
+		ttMove = entry.move
+	}
+	var childBuf [maxPly]bitChild
+	children := this.orderChildren(moves, childBuf[:0], ttMove, 0)
+
+	alpha := -abInf
+	bestMove := children[0].move
+	for i, ch := range children {
+		if this.cancelled() {
+			return this.pos.Move(bestMove), alpha, true
+		}
+		this.pos.Make(ch.move)
+		score := 0
+		if i == 0 {
+			score = -this.alphaBeta(depth-1, -abInf, abInf, 1)
+		} else if score = -this.alphaBeta(depth-1, -alpha-1, -alpha, 1); score > alpha {
+			score = -this.alphaBeta(depth-1, -abInf, -alpha, 1)
+		}
+		this.pos.Unmake()
+		if score > alpha {
+			alpha = score
+			bestMove = ch.move
+		}
+		// Only a win on the move can't be bettered; other wins may have shorter ones after them.
+		if alpha >= abInf-1 {
+			break
+		}
+	}
+	this.store(depth, alpha, -abInf, abInf, bestMove, 0)
+	return this.pos.Move(bestMove), alpha, true
+}
+
 func evalGlobal(state State, recursion int) State {
 	if recursion <= 0 || state.Winner != None {
 		return state
@@ -1,75 +1,68 @@
 package main
 
+import "math/bits"
+
 const (
 	abInf = int(1e9)
+	// wonBoardWeight is what a won board is worth compared to a single threat inside a board.
+	wonBoardWeight = 8
 )
 
-func countRow(value PlayerGettable, line int, player Player) int {
+// evalLocal counts the lines of a size x size board that are one mark short of winning:
+// +1 for each of player's, -1 for each of the opponent's.
+func evalLocal(value PlayerGettable, size int, line int, player Player) int {
 	ans := 0
-	for i := range 3 {
-		if value.Get(line, i) == player {
-			ans++
-		} else if value.Get(line, i) == 1-player {
-			ans--
-		}
-	}
-	return ans
-}
-func countColumn(value PlayerGettable, column int, player Player) int {
-	ans := 0
-	for i := range 3 {
-		if value.Get(i, column) == player {
-			ans++
-		} else if value.Get(i, column) == 1-player {
-			ans--
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			for _, d := range lineDirections {
+				endX, endY := i+d[0]*(line-1), j+d[1]*(line-1)
+				if endX < 0 || endX >= size || endY < 0 || endY >= size {
+					continue
+				}
+				mine, theirs := 0, 0
+				for k := range line {
+					switch value.Get(i+d[0]*k, j+d[1]*k) {
+					case player:
+						mine++
+					case 1 - player:
+						theirs++
+					}
+				}
+				if mine == line-1 && theirs == 0 {
+					ans++
+				} else if theirs == line-1 && mine == 0 {
+					ans--
+				}
+			}
 		}
 	}
 	return ans
 }
-func evalLocal(value PlayerGettable, player Player) int {
-	ans := 0
-	countDiagonal := 0
-	countSideDiagonal := 0
-	for i := range 3 {
-		switch value := countColumn(value, i, player); value {
-		case 2:
-			ans++
-		case -2:
-			ans--
-		}
-		switch value := countRow(value, i, player); value {
-		case 2:
-			ans++
-		case -2:
-			ans--
-		}
-		if value.Get(i, i) == player {
-			countDiagonal++
-		} else if value.Get(i, i) == 1-player {
-			countDiagonal--
-		}
-		if value.Get(i, 2-i) == player {
-			countSideDiagonal++
-		} else if value.Get(i, 2-i) == 1-player {
-			countSideDiagonal--
+
+// evalNested scores the nested boards of a board from player's perspective: a won board is worth
+// weight, an open one is scored by its own threats and, further down, its nested boards.
+func evalNested(boards [][]LocalState, rules Rules, player Player, weight int) int {
+	answer := 0
+	for _, row := range boards {
+		for _, local := range row {
+			if local.Winner == player {
+				answer += weight
+			} else if local.Winner == 1-player {
+				answer -= weight
+			} else if local.Boards == nil {
+				answer += evalLocal(local, rules.Size, rules.Line, player)
+			} else {
+				inner := weight / wonBoardWeight
+				answer += inner*evalLocal(local, rules.Size, rules.Line, player) + evalNested(local.Boards, rules, player, inner)
+			}
 		}
 	}
-	if countDiagonal == 2 {
-		ans++
-	}
-	if countDiagonal == -2 {
-		ans--
-	}
-	if countSideDiagonal == 2 {
-		ans++
-	}
-	if countSideDiagonal == -2 {
-		ans--
-	}
-	return ans
+	return answer
 }
 
 // EvaluateFor returns a heuristic evaluation from the perspective of player (higher is better for player).
+// It is the evaluation with DefaultWeights generalized to any geometry; classic geometry games are
+// searched on Positions, whose evaluation can be given other weights (see weights.go).
 func EvaluateFor(state State, player Player) int {
 	if state.Winner == player {
 		return abInf
@@ -78,18 +71,16 @@ func EvaluateFor(state State, player Player) int {
 		return -abInf
 	}
 
-	answer := 8 * evalLocal(state, player) // global alignment
-	for i := range 3 {                     // local occupancy + local threats
-		for j := range 3 {
-			if player == state.Get(i, j) {
-				answer += 8
-			} else if player == 1-state.Get(i, j) {
-				answer -= 8
-			} else {
-				answer += evalLocal(state.Values[i][j], player)
-			}
-		}
+	weight := 1
+	for range state.Rules.Depth - 1 {
+		weight *= wonBoardWeight
 	}
+	answer := weight * evalLocal(state, state.Rules.Size, state.Rules.Line, player) // global alignment
+	if state.Rules.Variant == VariantMisere {
+		// Lines of won boards lose in misère.
+		answer = -answer
+	}
+	answer += evalNested(state.Values, state.Rules, player, weight) // local occupancy + local threats
 	return answer
 }
 
@@ -97,3 +88,29 @@ func EvaluateFor(state State, player Player) int {
 func evaluate(state State) int {
 	return EvaluateFor(state, state.ToMove)
 }
+
+// threatTable[mine<<9|theirs] is evalLocal for a 3x3 board holding the cells in mine and theirs.
+var threatTable [1 << 18]int8
+
+func init() {
+	for mine := range uint16(1 << 9) {
+		for theirs := range uint16(1 << 9) {
+			if mine&theirs != 0 {
+				continue
+			}
+			ans := 0
+			for _, line := range lineMasks {
+				if bits.OnesCount16(mine&line) == 2 && theirs&line == 0 {
+					ans++
+				} else if bits.OnesCount16(theirs&line) == 2 && mine&line == 0 {
+					ans--
+				}
+			}
+			threatTable[int(mine)<<9|int(theirs)] = int8(ans)
+		}
+	}
+}
+
+func threats(mine uint16, theirs uint16) int {
+	return int(threatTable[int(mine)<<9|int(theirs)])
+}
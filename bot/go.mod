@@ -1,3 +1,3 @@
-module main
+module bot
 
 go 1.25.5
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// BestMoveIterative searches depth 1, 2, ... up to maxDepth until ctx is done, and returns the
+// best move of the last depth it completed. If not even depth 1 completes in time it falls back
+// to the best move found so far.
+//
+// Classic geometry games are searched on threads goroutines (lazy SMP): helpers run the same
+// iterative deepening, half of them a depth ahead, and only share their results through the
+// transposition table, which lets the main search cut off earlier. Other games use one.
+//
+// The evaluation uses weights; the generic search of other games uses DefaultWeights.
+// onIteration, if not nil, is called with the Info of each completed depth.
+func BestMoveIterative(ctx context.Context, state State, maxDepth int, threads int, weights *Weights, onIteration func(Info)) (Move, Info, bool) {
+	return bestMoveIterative(ctx, state, maxDepth, threads, sharedTT(), weights, onIteration)
+}
+
+// bestMoveIterative is BestMoveIterative on tt instead of the shared table.
+func bestMoveIterative(ctx context.Context, state State, maxDepth int, threads int, tt *transpositionTable, weights *Weights, onIteration func(Info)) (Move, Info, bool) {
+	// Searching deeper than the number of empty cells finds nothing new.
+	maxDepth = max(1, min(maxDepth, countEmpty(state)))
+
+	if pos, ok := NewPosition(state); ok {
+		return searchParallel(ctx, pos, maxDepth, threads, tt, weights, onIteration)
+	}
+
+	var best Move
+	var info Info
+	for depth := 1; depth <= maxDepth; depth++ {
+		move, ok := BestMoveCtx(ctx, state, depth)
+		if !ok {
+			return Move{}, info, false
+		}
+		if ctx.Err() != nil {
+			if depth == 1 {
+				best = move
+			}
+			break
+		}
+		best, info.Depth = move, depth
+		if onIteration != nil {
+			onIteration(Info{Depth: depth, PV: []Move{move}})
+		}
+	}
+	return best, info, true
+}
+
+func searchParallel(ctx context.Context, pos Position, maxDepth int, threads int, tt *transpositionTable, weights *Weights, onIteration func(Info)) (Move, Info, bool) {
+	helperCtx, stopHelpers := context.WithCancel(ctx)
+	helpers := make([]*positionSearch, max(threads-1, 0))
+	var wg sync.WaitGroup
+	for i := range helpers {
+		helpers[i] = newPositionSearch(helperCtx, pos, tt, weights)
+		wg.Add(1)
+		go func(search *positionSearch, from int) {
+			defer wg.Done()
+			search.iterate(from, maxDepth)
+		}(helpers[i], 1+(i+1)%2)
+	}
+
+	search := newPositionSearch(ctx, pos, tt, weights)
+	search.onIteration = onIteration
+	move, info, ok := search.iterate(1, maxDepth)
+	stopHelpers()
+	wg.Wait()
+	for _, s := range append(helpers, search) {
+		info.Nodes += s.nodes
+		info.TTProbes += s.probes
+		info.TTHits += s.hits
+	}
+	return move, info, ok
+}
+
+func (this *positionSearch) iterate(from int, maxDepth int) (Move, Info, bool) {
+	var best Move
+	var info Info
+	for depth := min(from, maxDepth); depth <= maxDepth; depth++ {
+		move, score, ok := this.bestMove(depth)
+		if !ok {
+			return Move{}, info, false
+		}
+		if this.stopped {
+			if depth == from {
+				best = move
+			}
+			break
+		}
+		best, info.Depth, info.Score = move, depth, score
+		if this.onIteration != nil {
+			// Only the main search reports, with its own nodes.
+			this.onIteration(Info{Depth: depth, Score: score, Nodes: this.nodes, TTProbes: this.probes, TTHits: this.hits,
+				PV: this.principalVariation(depth)})
+		}
+		// A proven win or loss won't change with more depth.
+		if score >= abInf-maxPly || score <= -(abInf-maxPly) {
+			break
+		}
+	}
+	return best, info, true
+}
+
+// principalVariation follows the best moves the table holds from the root, at most depth of them.
+func (this *positionSearch) principalVariation(depth int) []Move {
+	pos := this.pos
+	var pv []Move
+	var moveBuf [maxPly]bitMove
+	for len(pv) < depth && pos.winner == None {
+		entry, ok := this.tt.probe(pos.hash ^ this.salt)
+		if !ok || !slices.Contains(pos.Moves(moveBuf[:0]), entry.move) {
+			break
+		}
+		pv = append(pv, pos.Move(entry.move))
+		pos.Make(entry.move)
+	}
+	return pv
+}
+
+// countEmpty counts the empty cells on the bottom-level boards.
+func countEmpty(state State) int {
+	count := 0
+	var walk func(boards [][]LocalState)
+	walk = func(boards [][]LocalState) {
+		for _, row := range boards {
+			for _, local := range row {
+				if local.Boards != nil {
+					walk(local.Boards)
+					continue
+				}
+				for _, values := range local.Values {
+					for _, v := range values {
+						if v == None {
+							count++
+						}
+					}
+				}
+			}
+		}
+	}
+	walk(state.Values)
+	return count
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countdownContext is done after Done has been called calls times, which stops a search after
+// about that many nodes, at the same point every run.
+type countdownContext struct {
+	context.Context
+	calls atomic.Int64
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newCountdownContext(calls int64) *countdownContext {
+	ctx := &countdownContext{Context: context.Background(), done: make(chan struct{})}
+	ctx.calls.Store(calls)
+	return ctx
+}
+
+func (this *countdownContext) Done() <-chan struct{} {
+	if this.calls.Add(-1) <= 0 {
+		this.once.Do(func() { close(this.done) })
+	}
+	return this.done
+}
+
+func (this *countdownContext) Err() error {
+	select {
+	case <-this.done:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+func TestIterativeCancelled(t *testing.T) {
+	// The best move changes from depth 4 to 5 and again to 6, so a half-searched iteration can
+	// prefer another move than the last completed one.
+	state, err := benchPositions[2].state()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// completedMoves[depth] is the move of an uninterrupted single-threaded search to depth,
+	// which a cancelled one on an empty table must have found at that depth too.
+	completedMoves := map[int]Move{}
+	completedMove := func(depth int) Move {
+		if _, ok := completedMoves[depth]; !ok {
+			move, info, ok := bestMoveIterative(context.Background(), state, depth, 1, newTranspositionTable(1<<18), &DefaultWeights, nil)
+			if !ok || info.Depth != depth {
+				t.Fatalf("searched to depth %d, want %d", info.Depth, depth)
+			}
+			completedMoves[depth] = move
+		}
+		return completedMoves[depth]
+	}
+
+	depths := map[int]bool{}
+	for calls := int64(200); calls < 1<<18; calls = calls * 5 / 4 {
+		completed := 0
+		move, info, ok := bestMoveIterative(newCountdownContext(calls), state, maxPly, 1, newTranspositionTable(1<<18), &DefaultWeights, func(info Info) {
+			completed = info.Depth
+		})
+		if !ok || completed == 0 {
+			t.Fatalf("stopped after %d nodes with no depth completed", calls)
+		}
+		if info.Depth != completed || move != completedMove(completed) {
+			t.Fatalf("stopped after %d nodes: move %s at depth %d, want the move of depth %d, %s", calls,
+				MoveNotation(ClassicRules, move), info.Depth, completed, MoveNotation(ClassicRules, completedMove(completed)))
+		}
+		depths[completed] = true
+	}
+	if !depths[4] || !depths[5] {
+		t.Fatalf("completed depths %v when stopped, want stops during depths 5 and 6", depths)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Level is a named playing strength: it caps the search and makes the bot err on purpose.
+type Level struct {
+	Name  string
+	Depth int           // deepest search iteration; 0 doesn't limit it
+	Time  time.Duration // most thinking time per move; 0 doesn't limit it
+	// Noise, in evaluation units, is added to each move's score at random (from -Noise to Noise);
+	// it only applies to classic geometry games.
+	Noise int
+	// Blunder is the probability of playing a random legal move instead of searching.
+	Blunder float64
+}
+
+// Levels are the difficulty levels, weakest first; the last one is the bot at full strength.
+var Levels = []Level{
+	{Name: "beginner", Depth: 1, Noise: 16, Blunder: 0.3},
+	{Name: "easy", Depth: 2, Noise: 8, Blunder: 0.1},
+	{Name: "medium", Depth: 4, Time: 250 * time.Millisecond, Noise: 3, Blunder: 0.02},
+	{Name: "hard", Depth: 8, Time: 500 * time.Millisecond},
+	{Name: LevelMax},
+}
+
+const LevelMax = "max"
+
+func LevelByName(name string) (Level, bool) {
+	for _, level := range Levels {
+		if level.Name == name {
+			return level, true
+		}
+	}
+	return Level{}, false
+}
+
+func LevelNames() []string {
+	names := make([]string, len(Levels))
+	for i, level := range Levels {
+		names[i] = level.Name
+	}
+	return names
+}
+
+// levelEngine plays engine at a level: it applies the level's limits, blunders, and, if the
+// level is noisy, scores the moves itself with a fixed-depth search instead of asking engine.
+type levelEngine struct {
+	level   Level
+	engine  Engine
+	weights *Weights
+	tt      *transpositionTable
+	rng     *rand.Rand
+}
+
+// WithLevel makes engine play at level; weights are what a noisy level scores moves with, on tt,
+// or the shared table if tt is nil.
+func WithLevel(engine Engine, level Level, weights *Weights, tt *transpositionTable, seed int64) Engine {
+	if level.Depth == 0 && level.Time == 0 && level.Noise == 0 && level.Blunder == 0 {
+		return engine
+	}
+	if tt == nil {
+		tt = sharedTT()
+	}
+	return &levelEngine{level: level, engine: engine, weights: weights, tt: tt, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (this *levelEngine) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	if state.Winner != None {
+		return NoMove, Info{}
+	}
+	if this.level.Depth > 0 && (limits.Depth == 0 || limits.Depth > this.level.Depth) {
+		limits.Depth = this.level.Depth
+	}
+	if this.level.Time > 0 && (limits.Time == 0 || limits.Time > this.level.Time) {
+		limits.Time = this.level.Time
+	}
+	if this.rng.Float64() < this.level.Blunder {
+		moves := LegalMoves(state)
+		if len(moves) == 0 {
+			return NoMove, Info{}
+		}
+		return moves[this.rng.Intn(len(moves))], Info{Nodes: 1}
+	}
+	if pos, ok := NewPosition(state); ok && this.level.Noise > 0 && limits.Depth > 0 {
+		return this.noisySearch(ctx, pos, limits)
+	}
+	return this.engine.Search(ctx, state, limits)
+}
+
+// noisySearch searches every root move to limits.Depth and plays the best after adding noise
+// to the scores. When time runs out it picks among the moves searched so far.
+func (this *levelEngine) noisySearch(ctx context.Context, pos Position, limits Limits) (Move, Info) {
+	ctx, cancel := withLimit(ctx, limits)
+	defer cancel()
+	start := time.Now()
+	search := newPositionSearch(ctx, pos, this.tt, this.weights)
+	best, bestScore := noMove, 0
+	for _, m := range pos.Moves(nil) {
+		search.pos.Make(m)
+		score := -search.alphaBeta(limits.Depth-1, -abInf, abInf, 1)
+		search.pos.Unmake()
+		if search.stopped && best != noMove {
+			break
+		}
+		score += this.rng.Intn(2*this.level.Noise+1) - this.level.Noise
+		if best == noMove || score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	info := Info{Depth: limits.Depth, Score: bestScore, Nodes: search.nodes, TTProbes: search.probes, TTHits: search.hits,
+		Time: time.Since(start)}
+	if best == noMove {
+		return NoMove, info
+	}
+	return pos.Move(best), info
+}
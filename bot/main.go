@@ -10,12 +10,16 @@ import (
 
 const (
 	defaultBaseURL   = "http://localhost:8080"
-	searchDepth      = 5
+	maxSearchDepth   = maxPly
 	matchmakeEvery   = 1 * time.Minute
+	claimEvery       = 1 * time.Second
 	startGameTimeout = 1 * time.Second
 	actionTimeout    = 1 * time.Second
 	pollInterval     = 250 * time.Millisecond
-	gameMaxDuration  = 1 * time.Hour
+	// networkMargin is the part of actionTimeout kept for fetching the state and sending the move.
+	networkMargin   = 250 * time.Millisecond
+	minThinkTime    = 50 * time.Millisecond
+	gameMaxDuration = 1 * time.Hour
 )
 
 func sleepCtx(ctx context.Context, d time.Duration) error {
@@ -29,7 +33,10 @@ func sleepCtx(ctx context.Context, d time.Duration) error {
 	}
 }
 
-func runSinglePlayer(ctx context.Context, baseURL string, id int64, depth int, poll time.Duration, actionTimeout time.Duration) error {
+func runSinglePlayer(ctx context.Context, baseURL string, id int64, config botConfig, poll time.Duration, actionTimeout time.Duration) error {
+	// Games have no clock, so every move gets what the action timeout leaves.
+	budget := actionTimeout - networkMargin
+	engine := config.newEngine(time.Now().UnixNano(), nil)
 	lastStatusLog := time.Now()
 	for {
 		select {
@@ -61,9 +68,9 @@ func runSinglePlayer(ctx context.Context, baseURL string, id int64, depth int, p
 			continue
 		}
 
-		reqCtx, cancel = context.WithTimeout(ctx, actionTimeout)
+		reqCtx, cancel = context.WithTimeout(ctx, budget+networkMargin)
 		thinkStart := time.Now()
-		mv, next, err := PlayBestMove(reqCtx, baseURL, id, depth)
+		mv, info, next, err := PlayBestMove(reqCtx, baseURL, id, engine, config.limits(budget))
 		cancel()
 		if err != nil {
 			fmt.Printf("think failed: id=%d role=%d toMove=%d location=%d err=%v\n", id, ms.Role, st.ToMove, st.Location, err)
@@ -72,37 +79,57 @@ func runSinglePlayer(ctx context.Context, baseURL string, id int64, depth int, p
 			}
 			continue
 		}
-		_ = thinkStart // reserved for future timing logs if needed
-		fmt.Printf("played id=%d role=%d move=(%d,%d)->(%d,%d) nextToMove=%d winner=%d\n",
-			id, ms.Role, mv.CellX, mv.CellY, mv.FinalX, mv.FinalY, next.ToMove, next.Winner)
+		fmt.Printf("played id=%d role=%d level=%s move=(%d,%d)->(%d,%d) depth=%d nodes=%d iterations=%d tt_hits=%.1f%% proof=%q book=%t took=%s budget=%s nextToMove=%d winner=%d\n",
+			id, ms.Role, config.Level.Name, mv.CellX, mv.CellY, mv.FinalX, mv.FinalY, info.Depth, info.Nodes, info.Iterations, info.TTHitRate(), info.Proof(), info.Book,
+			time.Since(thinkStart).Round(time.Millisecond), budget, next.ToMove, next.Winner)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	ctx := context.Background()
 
 	baseURL := os.Getenv("BOT_BASE_URL")
 	if baseURL == "" {
 		baseURL = defaultBaseURL
 	}
+	// Shared with the backend, which only hands seats of games against the bot to the bot.
+	secret := os.Getenv("BOT_SECRET")
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
 
-	fmt.Printf("bot started: base=%s depth=%d matchmakingEvery=%s gameTimeout=%s\n",
-		baseURL, searchDepth, matchmakeEvery, gameMaxDuration)
+	if err := startAnalysisServer(config); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("bot started: base=%s engine=%s threads=%d level=%s maxDepth=%d matchmakingEvery=%s gameTimeout=%s\n",
+		baseURL, config.Engine, config.Threads, config.Level.Name, maxSearchDepth, matchmakeEvery, gameMaxDuration)
 
 	var activeGames int64
 
-	startGame := func() {
-		startCtx, cancel := context.WithTimeout(ctx, startGameTimeout)
-		ms, err := StartGame(startCtx, baseURL)
-		cancel()
-		if err != nil {
-			fmt.Printf("start game failed (retry in %s): %v\n", matchmakeEvery, err)
-			return
+	enterGame := func(ms MyState) {
+		gameConfig := config
+		if ms.Options.BotLevel != "" {
+			if level, ok := LevelByName(ms.Options.BotLevel); ok {
+				gameConfig.Level = level
+			} else {
+				fmt.Printf("unknown level %q: id=%d, playing at %s\n", ms.Options.BotLevel, ms.Id, config.Level.Name)
+			}
 		}
-
 		n := atomic.AddInt64(&activeGames, 1)
-		fmt.Printf("entered game: id=%d role=%d toMove=%d location=%d active=%d\n",
-			ms.Id, ms.Role, ms.GameState.ToMove, ms.GameState.Location, n)
+		fmt.Printf("entered game: id=%d role=%d toMove=%d location=%d level=%s active=%d\n",
+			ms.Id, ms.Role, ms.GameState.ToMove, ms.GameState.Location, gameConfig.Level.Name, n)
 
 		go func(id int64) {
 			defer func() {
@@ -111,7 +138,7 @@ func main() {
 			}()
 			gameCtx, cancel := context.WithTimeout(context.Background(), gameMaxDuration)
 			defer cancel()
-			err := runSinglePlayer(gameCtx, baseURL, id, searchDepth, pollInterval, actionTimeout)
+			err := runSinglePlayer(gameCtx, baseURL, id, gameConfig, pollInterval, actionTimeout)
 			if err == context.DeadlineExceeded {
 				fmt.Printf("game timed out: id=%d after=%s\n", id, gameMaxDuration)
 				return
@@ -122,6 +149,41 @@ func main() {
 		}(ms.Id)
 	}
 
+	startGame := func() {
+		startCtx, cancel := context.WithTimeout(ctx, startGameTimeout)
+		ms, err := StartGame(startCtx, baseURL)
+		cancel()
+		if err != nil {
+			fmt.Printf("start game failed (retry in %s): %v\n", matchmakeEvery, err)
+			return
+		}
+		enterGame(ms)
+	}
+
+	// Players who asked for the bot get it without waiting for matchmaking.
+	go func() {
+		ticker := time.NewTicker(claimEvery)
+		defer ticker.Stop()
+		failing := false
+		for range ticker.C {
+			claimCtx, cancel := context.WithTimeout(ctx, startGameTimeout)
+			ms, ok, err := ClaimBotGame(claimCtx, baseURL, secret)
+			cancel()
+			if err != nil {
+				// Once per outage rather than every second.
+				if !failing {
+					fmt.Printf("claiming bot games failed: %v\n", err)
+				}
+				failing = true
+				continue
+			}
+			failing = false
+			if ok {
+				enterGame(ms)
+			}
+		}
+	}()
+
 	// Try immediately, then every minute.
 	startGame()
 	ticker := time.NewTicker(matchmakeEvery)
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PlayoutRandom    = "random"
+	PlayoutHeuristic = "heuristic" // take moves that win a local board, otherwise play randomly
+
+	defaultExploration = math.Sqrt2
+	// mctsMaxNodes bounds the tree of a game, and mctsMaxTotalNodes the trees of all games kept at
+	// once; past either, leaves are played out without expanding. A node takes up to about 250
+	// bytes.
+	mctsMaxNodes      = 1 << 18
+	mctsMaxTotalNodes = 1 << 20
+)
+
+// mctsNodesHeld counts the nodes of the trees of all MCTS engines still in use.
+var mctsNodesHeld atomic.Int64
+
+type mctsNode struct {
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []bitMove
+	move     bitMove // the move leading here
+	hash     uint64  // of the position after move
+	visits   int
+	// reward sums the playout results from the perspective of the player who made move:
+	// 1 for a win, 0.5 for a draw.
+	reward float64
+}
+
+// MCTS is a Monte Carlo tree search (UCT) engine for classic geometry games; other games are
+// searched with alpha-beta instead. It keeps its tree between moves, so use one per game.
+type MCTS struct {
+	Exploration float64 // the UCT exploration constant
+	Playout     string  // PlayoutRandom or PlayoutHeuristic
+
+	rng  *rand.Rand
+	root *mctsNode
+	// nodes counts the tree's nodes in mctsNodesHeld, until the engine is collected.
+	nodes *int
+}
+
+func NewMCTS(playout string, seed int64) *MCTS {
+	engine := &MCTS{Exploration: defaultExploration, Playout: playout, rng: rand.New(rand.NewSource(seed)), nodes: new(int)}
+	runtime.AddCleanup(engine, func(nodes *int) { mctsNodesHeld.Add(-int64(*nodes)) }, engine.nodes)
+	return engine
+}
+
+// setNodes replaces the tree's node count, after part of the tree was dropped.
+func (this *MCTS) setNodes(n int) {
+	mctsNodesHeld.Add(int64(n - *this.nodes))
+	*this.nodes = n
+}
+
+func (this *MCTS) newNode(parent *mctsNode, move bitMove, pos *Position) *mctsNode {
+	*this.nodes++
+	mctsNodesHeld.Add(1)
+	node := &mctsNode{parent: parent, move: move, hash: pos.hash}
+	if pos.winner == None {
+		node.untried = pos.Moves(nil)
+	}
+	return node
+}
+
+// reuse returns the node of the tree kept from the last search for pos: the last root itself, or a
+// node one or two plies below it (after our move, and the opponent's reply).
+func (this *MCTS) reuse(pos *Position) *mctsNode {
+	if this.root == nil {
+		return nil
+	}
+	if this.root.hash == pos.hash {
+		return this.root
+	}
+	for _, child := range this.root.children {
+		if child.hash == pos.hash {
+			return child
+		}
+		for _, grandchild := range child.children {
+			if grandchild.hash == pos.hash {
+				return grandchild
+			}
+		}
+	}
+	return nil
+}
+
+// Search runs playouts from state until limits.Iterations are done or the time is up, and returns
+// the most visited move; without either limit it needs limits.Infinite or a deadline on ctx, and
+// otherwise returns NoMove. Depth is the length of the most visited line and Score the expected
+// result of the move in thousandths (500 is even).
+func (this *MCTS) Search(ctx context.Context, state State, limits Limits) (Move, Info) {
+	pos, ok := NewPosition(state)
+	if !ok {
+		return alphaBetaEngine{threads: 1, weights: &DefaultWeights, tt: sharedTT()}.Search(ctx, state, limits)
+	}
+	if len(pos.Moves(nil)) == 0 || pos.winner != None {
+		return NoMove, Info{}
+	}
+	if _, ok := ctx.Deadline(); !ok && limits.Iterations == 0 && limits.Time == 0 && !limits.Infinite {
+		return NoMove, Info{}
+	}
+	ctx, cancel := withLimit(ctx, limits)
+	defer cancel()
+	start := time.Now()
+
+	root := this.reuse(&pos)
+	if root == nil {
+		this.setNodes(0)
+		root = this.newNode(nil, noMove, &pos)
+	} else {
+		this.setNodes(countNodes(root))
+	}
+	root.parent = nil
+	this.root = root
+
+	iterations := 0
+	for limits.Iterations == 0 || iterations < limits.Iterations {
+		if iterations > 0 && iterations%64 == 0 && ctx.Err() != nil {
+			break
+		}
+		this.iterate(root, pos)
+		iterations++
+	}
+
+	best := mostVisited(root)
+	if best == nil {
+		// Only when no playout ran; iterate always expands the root.
+		return pos.Move(pos.Moves(nil)[0]), Info{Nodes: *this.nodes, Time: time.Since(start)}
+	}
+	depth := 0
+	for node := best; node != nil; node = mostVisited(node) {
+		depth++
+	}
+	score := 0
+	if best.visits > 0 {
+		score = int(1000 * best.reward / float64(best.visits))
+	}
+	info := Info{Depth: depth, Score: score, Nodes: *this.nodes, Iterations: iterations, Time: time.Since(start)}
+	return pos.Move(best.move), info
+}
+
+// mostVisited returns the child of node with the most visits, or nil if it has none.
+func mostVisited(node *mctsNode) *mctsNode {
+	var best *mctsNode
+	for _, child := range node.children {
+		if best == nil || child.visits > best.visits {
+			best = child
+		}
+	}
+	return best
+}
+
+// iterate selects a leaf with UCT, expands it, plays a game out from it and backs the result up.
+// pos is a copy of the root position it may change freely. The root is expanded whatever the
+// node limits, so that Search always has a move to return.
+func (this *MCTS) iterate(root *mctsNode, pos Position) {
+	node := root
+	for len(node.untried) == 0 && len(node.children) > 0 {
+		node = this.selectChild(node)
+		pos.Make(node.move)
+	}
+	if len(node.untried) > 0 && (node == root || *this.nodes < mctsMaxNodes && mctsNodesHeld.Load() < mctsMaxTotalNodes) {
+		i := this.rng.Intn(len(node.untried))
+		move := node.untried[i]
+		node.untried[i] = node.untried[len(node.untried)-1]
+		node.untried = node.untried[:len(node.untried)-1]
+		pos.Make(move)
+		child := this.newNode(node, move, &pos)
+		node.children = append(node.children, child)
+		node = child
+	}
+
+	winner := this.playout(&pos)
+	for ; node != nil; node = node.parent {
+		node.visits++
+		// The player who made node's move is the one not to move after it; the tree only holds
+		// positions on pos's path, so walk the side back up alongside.
+		mover := 1 - pos.toMove
+		if winner == mover {
+			node.reward++
+		} else if winner == None {
+			node.reward += 0.5
+		}
+		if node.parent != nil {
+			pos.Unmake()
+		}
+	}
+}
+
+func countNodes(node *mctsNode) int {
+	count := 1
+	for _, child := range node.children {
+		count += countNodes(child)
+	}
+	return count
+}
+
+// selectChild picks the child of node to descend to; node must have children.
+func (this *MCTS) selectChild(node *mctsNode) *mctsNode {
+	logVisits := math.Log(float64(node.visits))
+	best, bestValue := node.children[0], math.Inf(-1)
+	for _, child := range node.children {
+		value := child.reward/float64(child.visits) + this.Exploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+// playout plays random moves until the game ends and returns the winner, leaving pos where it
+// started.
+func (this *MCTS) playout(pos *Position) Player {
+	var buf [maxPly]bitMove
+	start := pos.ply
+	for pos.winner == None {
+		moves := pos.Moves(buf[:0])
+		if len(moves) == 0 {
+			break
+		}
+		pos.Make(this.pickPlayoutMove(pos, moves))
+	}
+	winner := pos.winner
+	for pos.ply > start {
+		pos.Unmake()
+	}
+	return winner
+}
+
+func (this *MCTS) pickPlayoutMove(pos *Position, moves []bitMove) bitMove {
+	if this.Playout == PlayoutHeuristic {
+		me := pos.toMove
+		closed := pos.won[Cross] | pos.won[Circle]
+		for _, m := range moves {
+			b, c := int(m/9), int(m%9)
+			if closed&(1<<b) == 0 && winTable[pos.cells[me][b]|1<<c] {
+				return m
+			}
+		}
+	}
+	return moves[this.rng.Intn(len(moves))]
+}
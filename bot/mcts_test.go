@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMCTSMovesWithTreesFull(t *testing.T) {
+	// Other games' trees hold every node allowed, so this search may not grow its own tree.
+	mctsNodesHeld.Add(mctsMaxTotalNodes)
+	defer mctsNodesHeld.Add(-mctsMaxTotalNodes)
+
+	engine := NewMCTS(PlayoutRandom, 1)
+	state := playNotation(t, ClassicRules, "e5 e4 d2")
+	for _, iterations := range []int{1, 100} {
+		move, info := engine.Search(context.Background(), state, Limits{Iterations: iterations})
+		if _, err := PerformMove(state, move); err != nil {
+			t.Fatalf("%d iterations: move %+v: %v", iterations, move, err)
+		}
+		if info.Iterations != iterations {
+			t.Fatalf("ran %d iterations, want %d", info.Iterations, iterations)
+		}
+	}
+}
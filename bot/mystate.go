@@ -1,7 +1,15 @@
 package main
 
+// GameOptions are the options a game was started with.
+type GameOptions struct {
+	Rated bool `json:"rated"`
+	// BotLevel is set in games a player started against the bot, at that difficulty level.
+	BotLevel string `json:"bot_level"`
+}
+
 type MyState struct {
-	GameState State  `json:"game_state"`
-	Role      Player `json:"role"`
-	Id        int64  `json:"id"`
+	GameState State       `json:"game_state"`
+	Role      Player      `json:"role"`
+	Id        int64       `json:"id"`
+	Options   GameOptions `json:"options"`
 }
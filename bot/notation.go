@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Moves are written like the backend's game records: as squares of the grid of all bottom-level
+// cells (9x9 in classic games), the file (a, b, ... z, aa, ab, ...) being the column, e.g.
+// CellY*3+FinalY, and the rank (1, 2, ...) the row, e.g. CellX*3+FinalX, counted from the top.
+
+// gridSide is the number of bottom-level cells along one side of the whole game.
+func gridSide(rules Rules) int {
+	side := 1
+	for range rules.Depth {
+		side *= rules.Size
+	}
+	return side
+}
+
+func MoveNotation(rules Rules, move Move) string {
+	path := move.path(rules)
+	row, column := 0, 0
+	for level := range rules.Depth {
+		row = row*rules.Size + path[level][0]
+		column = column*rules.Size + path[level][1]
+	}
+	file := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		file = string(rune('a'+(column-1)%26)) + file
+	}
+	return fmt.Sprintf("%s%d", file, row+1)
+}
+
+func ParseMoveNotation(rules Rules, text string, player Player) (Move, error) {
+	letters := strings.TrimRight(text, "0123456789")
+	row, err := strconv.Atoi(text[len(letters):])
+	if letters == "" || err != nil {
+		return Move{}, fmt.Errorf("invalid move %q", text)
+	}
+	column := 0
+	for _, letter := range letters {
+		if letter < 'a' || letter > 'z' {
+			return Move{}, fmt.Errorf("invalid move %q", text)
+		}
+		column = column*26 + int(letter-'a') + 1
+	}
+	row--
+	column--
+	side := gridSide(rules)
+	if row < 0 || row >= side || column < 0 || column >= side {
+		return Move{}, fmt.Errorf("invalid move %q", text)
+	}
+	var path [MaxDepth][2]int
+	for level := rules.Depth - 1; level >= 0; level-- {
+		path[level] = [2]int{row % rules.Size, column % rules.Size}
+		row /= rules.Size
+		column /= rules.Size
+	}
+	move := Move{Player: player, CellX: path[0][0], CellY: path[0][1]}
+	if rules.Depth > 2 {
+		move.MidX, move.MidY = path[1][0], path[1][1]
+	}
+	move.FinalX, move.FinalY = path[rules.Depth-1][0], path[rules.Depth-1][1]
+	return move, nil
+}
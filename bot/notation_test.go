@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMoveNotation(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		text  string
+		move  Move
+	}{
+		{ClassicRules, "a1", Move{Player: Cross}},
+		{ClassicRules, "e5", Move{Player: Cross, CellX: 1, CellY: 1, FinalX: 1, FinalY: 1}},
+		// The file is the column, the rank the row.
+		{ClassicRules, "e4", Move{Player: Cross, CellX: 1, CellY: 1, FinalX: 0, FinalY: 1}},
+		{ClassicRules, "c7", Move{Player: Cross, CellX: 2, CellY: 0, FinalX: 0, FinalY: 2}},
+		{ClassicRules, "i9", Move{Player: Cross, CellX: 2, CellY: 2, FinalX: 2, FinalY: 2}},
+		{rulesWith(4, 3, 2, VariantStandard), "p16", Move{Player: Cross, CellX: 3, CellY: 3, FinalX: 3, FinalY: 3}},
+		{rulesWith(3, 3, 3, VariantStandard), "aa27", Move{Player: Cross, CellX: 2, CellY: 2, MidX: 2, MidY: 2, FinalX: 2, FinalY: 2}},
+		{rulesWith(3, 3, 3, VariantStandard), "j1", Move{Player: Cross, CellY: 1, FinalY: 0}},
+		{rulesWith(5, 3, 3, VariantStandard), "du125", Move{Player: Cross, CellX: 4, CellY: 4, MidX: 4, MidY: 4, FinalX: 4, FinalY: 4}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%s", rulesName(test.rules), test.text), func(t *testing.T) {
+			move, err := ParseMoveNotation(test.rules, test.text, Cross)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if move != test.move {
+				t.Fatalf("parsed %+v, want %+v", move, test.move)
+			}
+			if text := MoveNotation(test.rules, move); text != test.text {
+				t.Fatalf("written as %q", text)
+			}
+		})
+	}
+}
+
+func TestMoveNotationRoundTrip(t *testing.T) {
+	for _, rules := range []Rules{ClassicRules, rulesWith(4, 3, 2, VariantStandard), rulesWith(5, 4, 3, VariantStandard)} {
+		t.Run(rulesName(rules), func(t *testing.T) {
+			seen := map[string]bool{}
+			for board := range rules.BoardCount() {
+				for x := range rules.Size {
+					for y := range rules.Size {
+						move := MoveAt(rules, Circle, board, x, y)
+						text := MoveNotation(rules, move)
+						if seen[text] {
+							t.Fatalf("%q names two cells", text)
+						}
+						seen[text] = true
+						parsed, err := ParseMoveNotation(rules, text, Circle)
+						if err != nil {
+							t.Fatalf("%q: %v", text, err)
+						}
+						if parsed != move {
+							t.Fatalf("%q parsed as %+v, want %+v", text, parsed, move)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseMoveNotationErrors(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		text  string
+	}{
+		{ClassicRules, ""},
+		{ClassicRules, "e"},
+		{ClassicRules, "5"},
+		{ClassicRules, "E5"},
+		{ClassicRules, "e0"},
+		{ClassicRules, "e10"},
+		{ClassicRules, "j1"},
+		{ClassicRules, "5e"},
+		{ClassicRules, "e-5"},
+		{rulesWith(3, 3, 3, VariantStandard), "ab1"},
+	}
+	for _, test := range tests {
+		if move, err := ParseMoveNotation(test.rules, test.text, Cross); err == nil {
+			t.Errorf("%s: %q parsed as %+v", rulesName(test.rules), test.text, move)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// Perft counts the positions reached from state after exactly depth plies, the standard check of a
+// move generator against known counts. Finished games are not played on, so a game ending before
+// depth adds nothing.
+func Perft(state State, depth int) int64 {
+	if depth == 0 {
+		return 1
+	}
+	var nodes int64
+	for _, move := range LegalMoves(state) {
+		next, err := PerformMove(state, move)
+		if err != nil {
+			panic(fmt.Sprintf("perft: legal move %+v rejected: %v", move, err))
+		}
+		nodes += Perft(next, depth-1)
+	}
+	return nodes
+}
+
+// PerftDivide is Perft by first move, in LegalMoves order, to find the move two generators
+// disagree under.
+func PerftDivide(state State, depth int) ([]Move, []int64) {
+	moves := LegalMoves(state)
+	counts := make([]int64, len(moves))
+	for i, move := range moves {
+		next, err := PerformMove(state, move)
+		if err != nil {
+			panic(fmt.Sprintf("perft: legal move %+v rejected: %v", move, err))
+		}
+		counts[i] = Perft(next, depth-1)
+	}
+	return moves, counts
+}
+
+// perft is Perft on the bitboard position, which must count the same.
+func (this *Position) perft(depth int) int64 {
+	if depth == 0 {
+		return 1
+	}
+	var buf [81]bitMove
+	moves := this.Moves(buf[:0])
+	if depth == 1 {
+		return int64(len(moves))
+	}
+	var nodes int64
+	for _, m := range moves {
+		this.Make(m)
+		nodes += this.perft(depth - 1)
+		this.Unmake()
+	}
+	return nodes
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// perftMidgame and perftEndgame are plies of a self-play game; games end under the endgame's tree.
+const (
+	perftMidgame = "a1 b1 e1 f1 h2 d5 c4 i2 g5 b5 f5 g6 a9 b9 e9 f9 i9 i8 h5 d6 b7 e2 d4 b3 e8 f6 g9 c7 i1 g3 a8 c5 i6 g8 a5 b4 d2 b6 e7 d1"
+	perftEndgame = perftMidgame + " b2 e4 f2 h4 d3 a7 c3 h8 e5 e6"
+)
+
+func rulesWith(size int, line int, depth int, variant string) Rules {
+	return Rules{Size: size, Line: line, Depth: depth, Variant: variant}
+}
+
+func playNotation(t testing.TB, rules Rules, moves string) State {
+	t.Helper()
+	state := NewState(rules)
+	for _, text := range strings.Fields(moves) {
+		move, err := ParseMoveNotation(rules, text, state.ToMove)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, err = PerformMove(state, move); err != nil {
+			t.Fatalf("move %s: %v", text, err)
+		}
+	}
+	return state
+}
+
+func TestPerft(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		moves string
+		nodes []int64 // by depth, from 1
+	}{
+		{"start", ClassicRules, "", []int64{81, 720, 6336, 55080}},
+		{"midgame", ClassicRules, perftMidgame, []int64{6, 55, 534, 5404, 50296}},
+		{"endgame", ClassicRules, perftEndgame, []int64{14, 148, 1352, 11444, 80955}},
+		{"open won boards", rulesWith(3, 3, 2, VariantOpenWonBoards), perftMidgame, []int64{6, 26, 118, 524}},
+		{"misere", rulesWith(3, 3, 2, VariantMisere), perftEndgame, []int64{14, 148, 1352, 11444}},
+		{"size 4", rulesWith(4, 3, 2, VariantStandard), "", []int64{256, 4080, 64800}},
+		{"three levels", rulesWith(3, 3, 3, VariantStandard), "", []int64{729, 6552, 58824}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := playNotation(t, test.rules, test.moves)
+			pos, classic := NewPosition(state)
+			for i, want := range test.nodes {
+				depth := i + 1
+				if got := Perft(state, depth); got != want {
+					t.Errorf("Perft(%d) = %d, want %d", depth, got, want)
+				}
+				if classic {
+					if got := pos.perft(depth); got != want {
+						t.Errorf("bitboard perft(%d) = %d, want %d", depth, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// allMoves lists every move of state.ToMove that names a cell, legal or not.
+func allMoves(state State) []Move {
+	rules := state.Rules
+	var moves []Move
+	for board := range rules.BoardCount() {
+		for x := range rules.Size {
+			for y := range rules.Size {
+				moves = append(moves, MoveAt(rules, state.ToMove, board, x, y))
+			}
+		}
+	}
+	return moves
+}
+
+// checkLegalMoves fails unless PerformMove accepts exactly the moves LegalMoves generates, and the
+// bitboard generator agrees for classic games.
+func checkLegalMoves(t *testing.T, state State) {
+	t.Helper()
+	legal := LegalMoves(state)
+	for _, move := range allMoves(state) {
+		_, err := PerformMove(state, move)
+		if listed := slices.Contains(legal, move); listed != (err == nil) {
+			t.Fatalf("move %s: listed=%v, PerformMove error %v\nstate: %+v", MoveNotation(state.Rules, move), listed, err, state)
+		}
+	}
+	if pos, ok := NewPosition(state); ok {
+		var bitMoves []Move
+		for _, m := range pos.Moves(nil) {
+			bitMoves = append(bitMoves, pos.Move(m))
+		}
+		if !slices.Equal(bitMoves, legal) {
+			t.Fatalf("bitboard moves %v, want %v", bitMoves, legal)
+		}
+	}
+}
+
+func TestLegalMovesMatchPerformMove(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, rules := range testRules {
+		t.Run(rulesName(rules), func(t *testing.T) {
+			// Fewer games on bigger boards, which take longer to check.
+			cells := rules.BoardCount() * rules.Size * rules.Size
+			for range max(1, 2000/cells) {
+				state := NewState(rules)
+				for {
+					checkLegalMoves(t, state)
+					// States from elsewhere may send the player to a board that can't be played on.
+					for board := range rules.BoardCount() {
+						if !state.Playable(board) {
+							sent := state
+							sent.Location = board
+							checkLegalMoves(t, sent)
+							break
+						}
+					}
+					moves := LegalMoves(state)
+					if len(moves) == 0 {
+						break
+					}
+					state, _ = PerformMove(state, moves[rng.Intn(len(moves))])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import "math/bits"
+
+const (
+	boardMask = 0x1ff // all 9 cells of a 3x3 board
+	maxPly    = 81
+)
+
+// bitMove is a move on a Position: board*9 + cell, both counted row by row.
+type bitMove uint8
+
+// winTable[mask] reports whether the 3x3 cells in mask contain a line.
+var winTable [1 << 9]bool
+
+// lineMasks are the 8 lines of a 3x3 board.
+var lineMasks = [8]uint16{0007, 0070, 0700, 0111, 0222, 0444, 0421, 0124}
+
+func init() {
+	for mask := range len(winTable) {
+		for _, line := range lineMasks {
+			if uint16(mask)&line == line {
+				winTable[mask] = true
+				break
+			}
+		}
+	}
+}
+
+type undo struct {
+	move     bitMove
+	forced   int8
+	winner   Player
+	wonBoard bool
+	hash     uint64
+}
+
+// Position is the bitboard form of a State with the classic geometry (3x3 boards, two levels),
+// which the search uses instead of copying States: moves are made and unmade in place.
+type Position struct {
+	cells   [2][9]uint16 // per player, the marks on each local board
+	won     [2]uint16    // per player, the local boards they won
+	toMove  Player
+	forced  int8 // the board the side to move must play on, -1 if any
+	winner  Player
+	variant string
+	history [maxPly]undo
+	ply     int
+	hash    uint64 // Zobrist hash, see zobrist.go
+}
+
+// NewPosition converts a State; it fails for states whose rules aren't the classic geometry.
+func NewPosition(state State) (Position, bool) {
+	rules := state.Rules
+	if rules.Size != 3 || rules.Line != 3 || rules.Depth != 2 {
+		return Position{}, false
+	}
+	p := Position{toMove: state.ToMove, forced: -1, winner: state.Winner, variant: rules.Variant}
+	for b := range 9 {
+		local := state.Values[b/3][b%3]
+		for c := range 9 {
+			if v := local.Values[c/3][c%3]; v != None {
+				p.cells[v][b] |= 1 << c
+			}
+		}
+		if local.Winner != None {
+			p.won[local.Winner] |= 1 << b
+		}
+	}
+	if state.Location != -1 && p.playable(state.Location) {
+		p.forced = int8(state.Location)
+	}
+	p.hash = p.computeHash()
+	return p, true
+}
+
+// State converts the position back.
+func (this *Position) State() State {
+	rules := ClassicRules
+	rules.Variant = this.variant
+	state := NewState(rules)
+	for b := range 9 {
+		local := &state.Values[b/3][b%3]
+		for player := range 2 {
+			for c := range 9 {
+				if this.cells[player][b]&(1<<c) != 0 {
+					local.Values[c/3][c%3] = Player(player)
+				}
+			}
+			if this.won[player]&(1<<b) != 0 {
+				local.Winner = Player(player)
+			}
+		}
+	}
+	state.ToMove = this.toMove
+	state.Location = int(this.forced)
+	state.Winner = this.winner
+	return state
+}
+
+func (this *Position) Move(m bitMove) Move {
+	b, c := int(m/9), int(m%9)
+	return Move{Player: this.toMove, CellX: b / 3, CellY: b % 3, FinalX: c / 3, FinalY: c % 3}
+}
+
+func (this *Position) occupied(b int) uint16 {
+	return this.cells[Cross][b] | this.cells[Circle][b]
+}
+
+// closed returns the boards nobody can play on anymore.
+func (this *Position) closed() uint16 {
+	var closed uint16
+	for b := range 9 {
+		if this.occupied(b) == boardMask {
+			closed |= 1 << b
+		}
+	}
+	if this.variant != VariantOpenWonBoards {
+		closed |= this.won[Cross] | this.won[Circle]
+	}
+	return closed
+}
+
+func (this *Position) playable(b int) bool {
+	if this.occupied(b) == boardMask {
+		return false
+	}
+	return this.variant == VariantOpenWonBoards || (this.won[Cross]|this.won[Circle])&(1<<b) == 0
+}
+
+// Moves appends the legal moves to buf, in the same order as LegalMoves; there are none once the
+// game is won.
+func (this *Position) Moves(buf []bitMove) []bitMove {
+	if this.winner != None {
+		return buf
+	}
+	if this.forced != -1 {
+		return this.appendBoardMoves(buf, int(this.forced))
+	}
+	open := ^this.closed() & boardMask
+	for open != 0 {
+		b := bits.TrailingZeros16(open)
+		open &= open - 1
+		buf = this.appendBoardMoves(buf, b)
+	}
+	return buf
+}
+
+func (this *Position) appendBoardMoves(buf []bitMove, b int) []bitMove {
+	empty := ^this.occupied(b) & boardMask
+	for empty != 0 {
+		c := bits.TrailingZeros16(empty)
+		empty &= empty - 1
+		buf = append(buf, bitMove(b*9+c))
+	}
+	return buf
+}
+
+// Make plays a legal move; Unmake takes back the last one made.
+func (this *Position) Make(m bitMove) {
+	b, c := int(m/9), int(m%9)
+	me := this.toMove
+	u := undo{move: m, forced: this.forced, winner: this.winner, hash: this.hash}
+	this.cells[me][b] |= 1 << c
+	this.hash ^= zobristCells[me][m] ^ zobristSide
+	// Boards keep their first winner when they stay in play after being won.
+	if (this.won[Cross]|this.won[Circle])&(1<<b) == 0 && winTable[this.cells[me][b]] {
+		this.won[me] |= 1 << b
+		this.hash ^= zobristWon[me][b]
+		u.wonBoard = true
+	}
+	this.history[this.ply] = u
+	this.ply++
+	this.toMove = 1 - me
+
+	this.forced = -1
+	if this.playable(c) {
+		this.forced = int8(c)
+	}
+	this.hash ^= zobristForced[u.forced+1] ^ zobristForced[this.forced+1]
+
+	if u.wonBoard && winTable[this.won[me]] {
+		this.winner = me
+		if this.variant == VariantMisere {
+			this.winner = 1 - me
+		}
+	} else if this.variant == VariantMajority && this.closed() == boardMask {
+		this.winner = this.majority()
+	}
+}
+
+func (this *Position) Unmake() {
+	this.ply--
+	u := this.history[this.ply]
+	b, c := int(u.move/9), int(u.move%9)
+	me := 1 - this.toMove
+	this.cells[me][b] &^= 1 << c
+	if u.wonBoard {
+		this.won[me] &^= 1 << b
+	}
+	this.toMove = me
+	this.forced = u.forced
+	this.winner = u.winner
+	this.hash = u.hash
+}
+
+func (this *Position) majority() Player {
+	cross, circle := bits.OnesCount16(this.won[Cross]), bits.OnesCount16(this.won[Circle])
+	switch {
+	case cross > circle:
+		return Cross
+	case circle > cross:
+		return Circle
+	}
+	return None
+}
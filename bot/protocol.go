@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The engine protocol is modelled on UCI, for tournament managers and GUIs: commands come one per
+// line, answers are written one per line. Moves are in record notation (see notation.go).
+//
+//	uci                          answers with the engine's name, its options and "uciok"
+//	isready                      answers "readyok"
+//	setoption name N value V     N is a bot setting named like its environment variable without
+//	                             the BOT_ prefix: engine, threads, level, weights, ...
+//	ucinewgame                   the next search starts a new game (a fresh engine)
+//	position startpos [moves M...]
+//	position rules K=V... [moves M...]
+//	                             a classic game, or a game with the given size, line, depth and
+//	                             variant, after the moves
+//	go [movetime MS] [depth D] [wtime MS btime MS [winc MS binc MS]] [infinite]
+//	                             searches the position, writing "info depth D score cp S|mate M
+//	                             nodes N time MS pv M..." lines as it goes and "bestmove M" at
+//	                             the end; without limits it thinks for defaultMoveTime, and
+//	                             the mcts engine, which depth doesn't limit, refuses depth alone
+//	stop                         ends the search early
+//	quit
+const (
+	protocolName    = "uttt-bot"
+	defaultMoveTime = 1 * time.Second
+	// clockMargin is kept off the clock for the manager's overhead.
+	clockMargin = 50 * time.Millisecond
+)
+
+type protocolEngine struct {
+	out      io.Writer
+	outMutex sync.Mutex
+
+	settings map[string]string // by environment variable, overriding the environment
+	config   botConfig
+	engine   Engine // created on the first search of a game
+	state    State
+
+	// The running search, if any.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// runProtocol speaks the engine protocol on in and out until quit or the end of in.
+func runProtocol(in io.Reader, out io.Writer) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	this := &protocolEngine{out: out, settings: map[string]string{}, config: config, state: NewState(ClassicRules)}
+	defer this.stop()
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch command, args := fields[0], fields[1:]; command {
+		case "uci":
+			this.send("id name %s", protocolName)
+			for _, variable := range configVariables {
+				this.send("option name %s type string", strings.ToLower(strings.TrimPrefix(variable, "BOT_")))
+			}
+			this.send("uciok")
+		case "isready":
+			this.send("readyok")
+		case "setoption":
+			this.stop()
+			this.setOption(args)
+		case "ucinewgame":
+			this.stop()
+			this.engine = nil
+		case "position":
+			this.stop()
+			if err := this.setPosition(args); err != nil {
+				this.send("info string %v", err)
+			}
+		case "go":
+			this.stop()
+			this.goSearch(args)
+		case "stop":
+			this.stop()
+		case "quit":
+			return nil
+		default:
+			this.send("info string unknown command %q", command)
+		}
+	}
+	return scanner.Err()
+}
+
+func (this *protocolEngine) send(format string, args ...any) {
+	this.outMutex.Lock()
+	defer this.outMutex.Unlock()
+	fmt.Fprintf(this.out, format+"\n", args...)
+}
+
+// stop ends the running search, if any, and waits for its bestmove.
+func (this *protocolEngine) stop() {
+	if this.cancel == nil {
+		return
+	}
+	this.cancel()
+	<-this.done
+	this.cancel, this.done = nil, nil
+}
+
+func (this *protocolEngine) setOption(args []string) {
+	// setoption name <name> value <value>; the value may be empty.
+	if len(args) < 2 || args[0] != "name" {
+		this.send("info string usage: setoption name <name> value <value>")
+		return
+	}
+	name, value := args[1], ""
+	if len(args) > 3 && args[2] == "value" {
+		value = strings.Join(args[3:], " ")
+	}
+	variable, ok := settingVariable(name)
+	if !ok {
+		this.send("info string unknown option %q", name)
+		return
+	}
+	settings := maps.Clone(this.settings)
+	settings[variable] = value
+	config, err := configFrom(func(variable string) string {
+		if value, ok := settings[variable]; ok {
+			return value
+		}
+		return os.Getenv(variable)
+	})
+	if err != nil {
+		this.send("info string %v", err)
+		return
+	}
+	this.settings, this.config, this.engine = settings, config, nil
+}
+
+func (this *protocolEngine) setPosition(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: position startpos|rules K=V... [moves M...]")
+	}
+	rules := ClassicRules
+	i := 1
+	switch args[0] {
+	case "startpos":
+	case "rules":
+		for ; i < len(args) && args[i] != "moves"; i++ {
+			key, value, _ := strings.Cut(args[i], "=")
+			n, err := strconv.Atoi(value)
+			switch {
+			case key == "variant":
+				rules.Variant = value
+			case key == "size" && err == nil:
+				rules.Size = n
+			case key == "line" && err == nil:
+				rules.Line = n
+			case key == "depth" && err == nil:
+				rules.Depth = n
+			default:
+				return fmt.Errorf("invalid rule %q", args[i])
+			}
+		}
+		if err := rules.Validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown position %q", args[0])
+	}
+
+	state := NewState(rules)
+	if i < len(args) && args[i] == "moves" {
+		for _, text := range args[i+1:] {
+			move, err := ParseMoveNotation(rules, text, state.ToMove)
+			if err != nil {
+				return err
+			}
+			if state, err = PerformMove(state, move); err != nil {
+				return fmt.Errorf("move %s: %v", text, err)
+			}
+		}
+	} else if i < len(args) {
+		return fmt.Errorf("unexpected %q", args[i])
+	}
+	if this.state.Rules != rules {
+		this.engine = nil
+	}
+	this.state = state
+	return nil
+}
+
+func (this *protocolEngine) goSearch(args []string) {
+	var moveTime, clock, increment time.Duration
+	depth := 0
+	infinite := false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			infinite = true
+			continue
+		}
+		if i+1 == len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			this.send("info string invalid %s %q", args[i], args[i+1])
+			return
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "movetime":
+			moveTime = ms
+		case "depth":
+			depth = n
+		case "wtime", "btime":
+			if (args[i] == "wtime") == (this.state.ToMove == Cross) {
+				clock = ms
+			}
+		case "winc", "binc":
+			if (args[i] == "winc") == (this.state.ToMove == Cross) {
+				increment = ms
+			}
+		}
+		i++
+	}
+	switch {
+	case infinite:
+		moveTime = 0
+	case moveTime == 0 && clock > 0:
+		moveTime = clockBudget(this.state, clock, increment)
+	case moveTime == 0 && depth == 0:
+		moveTime = defaultMoveTime
+	}
+
+	if this.engine == nil {
+		this.engine = this.config.newEngine(time.Now().UnixNano(), nil)
+	}
+	limits := this.config.limits(moveTime)
+	if depth > 0 {
+		limits.Depth = depth
+	}
+	limits.Infinite = infinite
+	if this.config.Engine == EngineMCTS && !infinite && limits.Time == 0 && limits.Iterations == 0 {
+		this.send("info string %s searches need movetime, a clock or infinite", EngineMCTS)
+		return
+	}
+	state, start := this.state, time.Now()
+	reported := false
+	limits.OnIteration = func(info Info) {
+		reported = true
+		info.Time = time.Since(start)
+		this.send("%s", infoLine(state, info))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	this.cancel, this.done = cancel, make(chan struct{})
+	go func(engine Engine, done chan struct{}) {
+		defer close(done)
+		move, info := engine.Search(ctx, state, limits)
+		if !reported && move != NoMove {
+			info.Time = time.Since(start)
+			if len(info.PV) == 0 {
+				info.PV = []Move{move}
+			}
+			this.send("%s", infoLine(state, info))
+		}
+		if move == NoMove {
+			this.send("bestmove (none)")
+			return
+		}
+		this.send("bestmove %s", MoveNotation(state.Rules, move))
+	}(this.engine, this.done)
+}
+
+// minPliesLeft keeps clockBudget from spending the whole clock when few cells remain but the game
+// could still go on (it usually ends well before the board fills up, but not always).
+const minPliesLeft = 20
+
+// clockBudget shares the mover's clock over its moves that may be left, plus the increment,
+// and never spends more than half of what remains.
+func clockBudget(state State, clock time.Duration, increment time.Duration) time.Duration {
+	moves := (max(countEmpty(state), minPliesLeft) + 1) / 2
+	budget := clock/time.Duration(moves) + increment
+	return max(minThinkTime, min(budget, (clock-clockMargin)/2))
+}
+
+func infoLine(state State, info Info) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "info depth %d", info.Depth)
+	switch {
+	case info.Proven && info.Outcome != OutcomeDraw:
+		moves := (info.Distance + 1) / 2
+		if info.Outcome == OutcomeLoss {
+			moves = -moves
+		}
+		fmt.Fprintf(&b, " score mate %d", moves)
+	case mateIn(info.Score) != 0:
+		fmt.Fprintf(&b, " score mate %d", mateIn(info.Score))
+	default:
+		fmt.Fprintf(&b, " score cp %d", info.Score)
+	}
+	fmt.Fprintf(&b, " nodes %d time %d", info.Nodes, info.Time.Milliseconds())
+	if len(info.PV) > 0 {
+		b.WriteString(" pv")
+		for _, move := range info.PV {
+			b.WriteString(" " + MoveNotation(state.Rules, move))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// protocolSession runs the engine protocol on script and returns the lines it answered with.
+func protocolSession(t *testing.T, script ...string) []string {
+	t.Helper()
+	for _, variable := range configVariables {
+		t.Setenv(variable, "")
+	}
+	var out strings.Builder
+	if err := runProtocol(strings.NewReader(strings.Join(script, "\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestProtocolHandshake(t *testing.T) {
+	lines := protocolSession(t, "uci", "isready", "frobnicate", "quit", "isready")
+	if lines[0] != "id name "+protocolName {
+		t.Fatalf("first line %q", lines[0])
+	}
+	want := []string{"uciok", "readyok", `info string unknown command "frobnicate"`}
+	if got := lines[len(lines)-len(want):]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("session ended with %q, want %q (nothing after quit)", got, want)
+	}
+}
+
+func TestProtocolSearch(t *testing.T) {
+	lines := protocolSession(t, "position startpos moves e5 e4 d2", "go depth 2")
+	if len(lines) < 2 {
+		t.Fatalf("answered %q, want info and bestmove lines", lines)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if !strings.HasPrefix(line, "info depth ") || !strings.Contains(line, " pv ") {
+			t.Fatalf("unexpected line %q before bestmove", line)
+		}
+	}
+	best, ok := strings.CutPrefix(lines[len(lines)-1], "bestmove ")
+	if !ok {
+		t.Fatalf("last line %q, want bestmove", lines[len(lines)-1])
+	}
+	state := playNotation(t, ClassicRules, "e5 e4 d2")
+	move, err := ParseMoveNotation(ClassicRules, best, state.ToMove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PerformMove(state, move); err != nil {
+		t.Fatalf("bestmove %s: %v", best, err)
+	}
+	// The principal variation starts with the move played.
+	if pv := strings.Fields(strings.SplitN(lines[len(lines)-2], " pv ", 2)[1]); pv[0] != best {
+		t.Fatalf("last pv %q doesn't start with bestmove %s", pv, best)
+	}
+}
+
+func TestProtocolPositionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+	}{
+		{"illegal move", "position startpos moves e5 a1"},
+		{"invalid move", "position startpos moves z99"},
+		{"invalid rules", "position rules size=9 moves e5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := protocolSession(t, test.command)
+			if len(lines) != 1 || !strings.HasPrefix(lines[0], "info string ") {
+				t.Fatalf("answered %q, want one info string", lines)
+			}
+		})
+	}
+}
+
+func TestProtocolGameOver(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	state, moves := NewState(ClassicRules), []string{}
+	for !state.IsOver() {
+		legal := LegalMoves(state)
+		move := legal[rng.Intn(len(legal))]
+		moves = append(moves, MoveNotation(ClassicRules, move))
+		state, _ = PerformMove(state, move)
+	}
+	lines := protocolSession(t, "position startpos moves "+strings.Join(moves, " "), "go depth 1")
+	if len(lines) != 1 || lines[0] != "bestmove (none)" {
+		t.Fatalf("answered %q in a finished game, want bestmove (none)", lines)
+	}
+}
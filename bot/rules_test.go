@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testRules are the geometries and variants the rules tests play.
+var testRules = []Rules{
+	rulesWith(3, 3, 2, VariantStandard),
+	rulesWith(3, 3, 2, VariantOpenWonBoards),
+	rulesWith(3, 3, 2, VariantMajority),
+	rulesWith(3, 3, 2, VariantMisere),
+	rulesWith(4, 3, 2, VariantStandard),
+	rulesWith(5, 4, 2, VariantMajority),
+	rulesWith(3, 3, 3, VariantStandard),
+}
+
+func rulesName(rules Rules) string {
+	return fmt.Sprintf("size %d depth %d line %d %s", rules.Size, rules.Depth, rules.Line, rules.Variant)
+}
+
+// checkWinners fails unless every board's winner is the one its cells make, and the game's winner
+// the one its variant makes of the outermost boards.
+func checkWinners(t *testing.T, state State) {
+	t.Helper()
+	rules := state.Rules
+	var check func(local LocalState, level int)
+	check = func(local LocalState, level int) {
+		if level < rules.Depth-1 {
+			for i, row := range local.Boards {
+				for j, nested := range row {
+					check(nested, level+1)
+					if local.Values[i][j] != nested.Winner {
+						t.Fatalf("level %d cell %d,%d holds %d, its board was won by %d", level, i, j, local.Values[i][j], nested.Winner)
+					}
+				}
+			}
+		}
+		// Boards keep their first winner, so only whether there is one can be checked.
+		if line := GetWinner(local, rules.Size, rules.Line); (line == None) != (local.Winner == None) {
+			t.Fatalf("level %d board has winner %d but its line is %d", level, local.Winner, line)
+		}
+	}
+	for _, row := range state.Values {
+		for _, local := range row {
+			check(local, 1)
+		}
+	}
+	want := GetWinner(state, rules.Size, rules.Line)
+	if want != None && rules.Variant == VariantMisere {
+		want = 1 - want
+	}
+	if want == None && rules.Variant == VariantMajority && state.IsOver() {
+		want = state.majority()
+	}
+	if state.Winner != want {
+		t.Fatalf("winner %d, want %d", state.Winner, want)
+	}
+}
+
+// checkMove plays move on state, failing unless PerformMove accepts it exactly when LegalMoves
+// lists it and leaves state as it was, and returns the next state if the move was legal.
+func checkMove(t *testing.T, state State, move Move) (State, bool) {
+	t.Helper()
+	before, _ := json.Marshal(state)
+	next, err := PerformMove(state, move)
+	if listed := slices.Contains(LegalMoves(state), move); listed != (err == nil) {
+		t.Fatalf("move %+v: listed=%v, PerformMove error %v", move, listed, err)
+	}
+	if after, _ := json.Marshal(state); string(after) != string(before) {
+		t.Fatalf("move %+v changed the state it was played on", move)
+	}
+	if err != nil {
+		return state, false
+	}
+	if next.ToMove != 1-state.ToMove {
+		t.Fatalf("move %+v by %d leaves %d to move", move, state.ToMove, next.ToMove)
+	}
+	checkWinners(t, next)
+	return next, true
+}
+
+func TestRandomPlayouts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, rules := range testRules {
+		t.Run(rulesName(rules), func(t *testing.T) {
+			cells := rules.BoardCount() * rules.Size * rules.Size
+			for range max(5, 5000/cells) {
+				state := NewState(rules)
+				plies := 0
+				for !state.IsOver() {
+					moves := LegalMoves(state)
+					if len(moves) == 0 {
+						t.Fatalf("no moves after %d plies though the game isn't over", plies)
+					}
+					var ok bool
+					if state, ok = checkMove(t, state, moves[rng.Intn(len(moves))]); !ok {
+						t.Fatalf("legal move rejected after %d plies", plies)
+					}
+					plies++
+					if plies > cells {
+						t.Fatalf("game goes on after every cell is taken")
+					}
+				}
+				if moves := LegalMoves(state); len(moves) > 0 {
+					t.Fatalf("finished game has moves %v", moves)
+				}
+				for _, move := range allMoves(state) {
+					if _, err := PerformMove(state, move); err == nil {
+						t.Fatalf("finished game accepts move %+v", move)
+					}
+				}
+			}
+		})
+	}
+}
+
+// FuzzPerformMove plays the moves the input picks, legal or not, from the start of a game.
+func FuzzPerformMove(f *testing.F) {
+	f.Add([]byte{0, 40, 0, 1, 2, 3})
+	f.Add([]byte{6, 0, 0, 255, 255, 17, 3})
+	f.Add([]byte{3, 4, 36, 40, 4, 36, 40, 4, 36, 40, 8, 72})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		state := NewState(testRules[int(data[0])%len(testRules)])
+		for i := 1; i+1 < len(data); i += 2 {
+			// The pick ranges over every cell for either player, and a few moves off the board.
+			moves := allMoves(state)
+			pick := int(data[i])<<8 | int(data[i+1])
+			var move Move
+			switch n := len(moves); {
+			case pick%(2*n+2) < n:
+				move = moves[pick%(2*n+2)]
+			case pick%(2*n+2) < 2*n:
+				move = moves[pick%(2*n+2)-n]
+				move.Player = 1 - move.Player
+			default:
+				move = Move{Player: state.ToMove, CellX: pick%7 - 1, MidX: pick % 5, FinalY: pick % 11}
+			}
+			state, _ = checkMove(t, state, move)
+		}
+	})
+}
+
+func FuzzStateJSON(f *testing.F) {
+	rng := rand.New(rand.NewSource(1))
+	for _, rules := range testRules {
+		state := NewState(rules)
+		for range rng.Intn(60) {
+			moves := LegalMoves(state)
+			if len(moves) == 0 {
+				break
+			}
+			state, _ = PerformMove(state, moves[rng.Intn(len(moves))])
+		}
+		data, _ := json.Marshal(state)
+		f.Add(data)
+	}
+	f.Add([]byte(`{"values":[],"to_move":0,"location":-1,"winner":2}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"values":[[{"values":[[5,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":7}],[{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2}],[{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2},{"values":[[2,2,2],[2,2,2],[2,2,2]],"winner":2}]],"to_move":3,"location":-1,"winner":2}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var state State
+		if json.Unmarshal(data, &state) != nil {
+			return
+		}
+		// A decoded state may be no game's, but the moves on it must still be consistent.
+		legal := LegalMoves(state)
+		for _, move := range allMoves(state) {
+			_, err := PerformMove(state, move)
+			if listed := slices.Contains(legal, move); listed != (err == nil) {
+				t.Fatalf("move %+v: listed=%v, PerformMove error %v", move, listed, err)
+			}
+		}
+		if pos, ok := NewPosition(state); ok {
+			var bitMoves []Move
+			for _, m := range pos.Moves(nil) {
+				bitMoves = append(bitMoves, pos.Move(m))
+			}
+			if !slices.Equal(bitMoves, legal) {
+				t.Fatalf("bitboard moves %v, want %v", bitMoves, legal)
+			}
+		}
+		state.IsOver()
+
+		again, err := json.Marshal(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded State
+		if err := json.Unmarshal(again, &decoded); err != nil {
+			t.Fatalf("decoding an encoded state: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, state) {
+			t.Fatalf("state changed through JSON: %+v, want %+v", decoded, state)
+		}
+	})
+}
+
+func FuzzMoveJSON(f *testing.F) {
+	f.Add([]byte(`{"player":0,"cellX":1,"cellY":1,"finalX":1,"finalY":1}`))
+	f.Add([]byte(`{"player":1,"cellX":2,"cellY":0,"midX":1,"midY":2,"finalX":0,"finalY":2}`))
+	f.Add([]byte(`{"player":7,"cellX":-1,"cellY":9,"finalX":100,"finalY":-3}`))
+	states := []State{NewState(ClassicRules), playNotation(f, ClassicRules, perftMidgame), NewState(rulesWith(3, 3, 3, VariantStandard))}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var move Move
+		if json.Unmarshal(data, &move) != nil {
+			return
+		}
+		for _, state := range states {
+			checkMove(t, state, move)
+		}
+	})
+}
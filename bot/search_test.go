@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// benchSuite returns the positions of the benchmark suite.
+func benchSuite(b *testing.B) []Position {
+	var positions []Position
+	for _, position := range benchPositions {
+		state, err := position.state()
+		if err != nil {
+			b.Fatal(err)
+		}
+		pos, _ := NewPosition(state)
+		positions = append(positions, pos)
+	}
+	return positions
+}
+
+// BenchmarkSearchThreads searches the suite to benchDepth with an empty table, so the time per op
+// compares the lazy SMP speedup across thread counts.
+func BenchmarkSearchThreads(b *testing.B) {
+	positions := benchSuite(b)
+	threadCounts := []int{1, 2, 4}
+	if cpus := runtime.NumCPU(); cpus > 4 {
+		threadCounts = append(threadCounts, cpus)
+	}
+	for _, threads := range threadCounts {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			tt := newTranspositionTable(ttEntries)
+			nodes := 0
+			for range b.N {
+				b.StopTimer()
+				tt.clear()
+				b.StartTimer()
+				for _, pos := range positions {
+					_, info, _ := searchParallel(context.Background(), pos, benchDepth, threads, tt, &DefaultWeights, nil)
+					nodes += info.Nodes
+				}
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
+
+// BenchmarkSearchNodes reports the nodes a single-threaded search of the positions visits at
+// fixed depths: the measure of move ordering and pruning.
+func BenchmarkSearchNodes(b *testing.B) {
+	positions := benchSuite(b)
+	for _, depth := range []int{6, 8, 10} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			tt := newTranspositionTable(ttEntries)
+			nodes := 0
+			for range b.N {
+				b.StopTimer()
+				tt.clear()
+				b.StartTimer()
+				for _, pos := range positions {
+					_, info, _ := searchParallel(context.Background(), pos, depth, 1, tt, &DefaultWeights, nil)
+					nodes += info.Nodes
+				}
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		})
+	}
+}
+
+// BenchmarkBestMove searches each position of the benchmark suite to benchDepth on a cleared
+// table, as the bench command does.
+func BenchmarkBestMove(b *testing.B) {
+	tt := newTranspositionTable(ttEntries)
+	for _, position := range benchPositions {
+		b.Run(position.Name, func(b *testing.B) {
+			var result BenchResult
+			nodes, elapsed := 0, time.Duration(0)
+			for range b.N {
+				var err error
+				if result, err = runBench(position, benchDepth, tt, &DefaultWeights); err != nil {
+					b.Fatal(err)
+				}
+				nodes += result.Nodes
+				elapsed += result.Time
+			}
+			b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+			b.ReportMetric(float64(nodes)/elapsed.Seconds(), "nodes/s")
+			b.Logf("move=%s", MoveNotation(ClassicRules, result.Move))
+		})
+	}
+}
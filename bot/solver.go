@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"math/bits"
+)
+
+// defaultSolveThreshold is the number of empty cells on playable boards at or below which the
+// alpha-beta engine tries to solve a position before searching it heuristically.
+const defaultSolveThreshold = 24
+
+// solvedDepth marks transposition table entries the solver proved; no heuristic search reaches
+// that depth, so they are only used as is by the solver, and as exact results by every search.
+const solvedDepth = maxPly + 1
+
+// Outcome is a proven game result from the perspective of the side to move.
+type Outcome int8
+
+const (
+	OutcomeLoss Outcome = -1
+	OutcomeDraw Outcome = 0
+	OutcomeWin  Outcome = 1
+)
+
+func (this Outcome) String() string {
+	switch this {
+	case OutcomeWin:
+		return "win"
+	case OutcomeLoss:
+		return "loss"
+	}
+	return "draw"
+}
+
+// openCells counts the empty cells on the boards that can still be played.
+func (this *Position) openCells() int {
+	count := 0
+	open := ^this.closed() & boardMask
+	for open != 0 {
+		b := bits.TrailingZeros16(open)
+		open &= open - 1
+		count += 9 - bits.OnesCount16(this.occupied(b))
+	}
+	return count
+}
+
+// Solve searches a classic geometry position to the end of the game. Unless ctx is done first, it
+// returns the best move with Info.Proven set: the outcome with best play and, for a win or a
+// loss, its distance in plies (the winner hurrying, the loser holding out).
+func Solve(ctx context.Context, state State) (Move, Info, bool) {
+	return solve(ctx, state, sharedTT())
+}
+
+// solve is Solve on tt instead of the shared table.
+func solve(ctx context.Context, state State, tt *transpositionTable) (Move, Info, bool) {
+	pos, ok := NewPosition(state)
+	if !ok || pos.winner != None {
+		return NoMove, Info{}, false
+	}
+	search := newPositionSearch(ctx, pos, tt, &DefaultWeights)
+	move, score, ok := search.solveRoot()
+	info := Info{Nodes: search.nodes, TTProbes: search.probes, TTHits: search.hits}
+	if !ok || search.stopped {
+		return NoMove, info, false
+	}
+	info.Proven, info.Score = true, score
+	switch {
+	case score > abInf-2*maxPly:
+		info.Outcome, info.Distance = OutcomeWin, abInf-score
+	case score < -(abInf - 2*maxPly):
+		info.Outcome, info.Distance = OutcomeLoss, abInf+score
+	}
+	info.Depth = info.Distance
+	return move, info, true
+}
+
+// SolveLine solves state and plays the proven line out to the end of the game, returning the
+// moves with the Info of the first solve.
+func SolveLine(ctx context.Context, state State) ([]Move, Info, bool) {
+	move, info, ok := Solve(ctx, state)
+	if !ok {
+		return nil, info, false
+	}
+	line := []Move{move}
+	for {
+		var err error
+		if state, err = PerformMove(state, move); err != nil {
+			return nil, info, false
+		}
+		if state.IsOver() {
+			return line, info, true
+		}
+		// The table holds the proof, so these are quick.
+		if move, _, ok = Solve(ctx, state); !ok {
+			return nil, info, false
+		}
+		line = append(line, move)
+	}
+}
+
+func (this *positionSearch) solveRoot() (Move, int, bool) {
+	var moveBuf [maxPly]bitMove
+	moves := this.pos.Moves(moveBuf[:0])
+	if len(moves) == 0 {
+		return NoMove, 0, false
+	}
+	ttMove := noMove
+	if entry, ok := this.tt.probe(this.key()); ok {
+		ttMove = entry.move
+	}
+	var childBuf [maxPly]bitChild
+	children := this.orderChildren(moves, childBuf[:0], ttMove, 0)
+
+	alpha := -abInf
+	bestMove := children[0].move
+	for _, ch := range children {
+		this.pos.Make(ch.move)
+		score := -this.solve(-abInf, -alpha, 1)
+		this.pos.Unmake()
+		if this.stopped {
+			return NoMove, 0, false
+		}
+		if score > alpha {
+			alpha = score
+			bestMove = ch.move
+		}
+	}
+	this.store(solvedDepth, alpha, -abInf, abInf, bestMove, 0)
+	return this.pos.Move(bestMove), alpha, true
+}
+
+// solve is alphaBeta without a depth limit or evaluation: every line is played to the end.
+func (this *positionSearch) solve(alpha int, beta int, ply int) int {
+	if this.cancelled() {
+		return 0
+	}
+	this.nodes++
+
+	me := this.pos.toMove
+	if this.pos.winner == me {
+		return abInf - ply
+	}
+	if this.pos.winner == 1-me {
+		return -(abInf - ply)
+	}
+	var moveBuf [maxPly]bitMove
+	moves := this.pos.Moves(moveBuf[:0])
+	if len(moves) == 0 {
+		return 0
+	}
+
+	alphaOrig, betaOrig := alpha, beta
+	ttMove, score, done := this.probe(solvedDepth, &alpha, &beta, ply)
+	if done {
+		this.cutoffs++
+		return score
+	}
+
+	var childBuf [maxPly]bitChild
+	children := this.orderChildren(moves, childBuf[:0], ttMove, ply)
+	best := -abInf
+	bestMove := children[0].move
+	for _, ch := range children {
+		this.pos.Make(ch.move)
+		score := -this.solve(-beta, -alpha, ply+1)
+		this.pos.Unmake()
+		if this.stopped {
+			return 0
+		}
+		if score > best {
+			best = score
+			bestMove = ch.move
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			if ch.score < orderKiller {
+				this.recordCutoff(ch.move, len(moves), ply)
+			}
+			break
+		}
+	}
+	this.store(solvedDepth, best, alphaOrig, betaOrig, bestMove, ply)
+	return best
+}
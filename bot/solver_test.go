@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// endgame plays a random classic game until at most open cells are left on playable boards, or
+// returns false if it ends first.
+func endgame(rng *rand.Rand, rules Rules, open int) (State, bool) {
+	state := NewState(rules)
+	for !state.IsOver() {
+		if pos, _ := NewPosition(state); pos.openCells() <= open {
+			return state, true
+		}
+		moves := LegalMoves(state)
+		state, _ = PerformMove(state, moves[rng.Intn(len(moves))])
+	}
+	return state, false
+}
+
+// minimax scores state for the side to move by playing every line out: abInf-n for a win n plies
+// away, -(abInf-n) for a loss, 0 for a draw.
+func minimax(state State) int {
+	if state.Winner != None {
+		if state.Winner == state.ToMove {
+			return abInf
+		}
+		return -abInf
+	}
+	best, any := -abInf, false
+	for _, move := range LegalMoves(state) {
+		next, err := PerformMove(state, move)
+		if err != nil {
+			panic(err)
+		}
+		best, any = max(best, -minimax(next)), true
+	}
+	switch {
+	case !any:
+		return 0
+	case best > 0:
+		return best - 1
+	case best < 0:
+		return best + 1
+	}
+	return 0
+}
+
+func TestSolveMatchesMinimax(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	seen := map[Outcome]int{}
+	for _, variant := range []string{VariantStandard, VariantMajority, VariantMisere} {
+		rules := ClassicRules
+		rules.Variant = variant
+		for solved := 0; solved < 8; {
+			state, ok := endgame(rng, rules, 8)
+			if !ok {
+				continue
+			}
+			solved++
+			_, info, ok := solve(context.Background(), state, newTranspositionTable(1<<16))
+			if !ok || !info.Proven {
+				t.Fatalf("%s: not solved", variant)
+			}
+			want, outcome, distance := minimax(state), OutcomeDraw, 0
+			if want > 0 {
+				outcome, distance = OutcomeWin, abInf-want
+			} else if want < 0 {
+				outcome, distance = OutcomeLoss, abInf+want
+			}
+			if info.Outcome != outcome || info.Distance != distance {
+				t.Fatalf("%s: solved as %v in %d, minimax says %v in %d", variant, info.Outcome, info.Distance, outcome, distance)
+			}
+			seen[outcome]++
+		}
+	}
+	if len(seen) < 3 {
+		t.Fatalf("outcomes %v: the positions don't cover wins, losses and draws", seen)
+	}
+}
+
+func TestSolveCancelled(t *testing.T) {
+	// A position that takes the solver a while, so a cancel lands in the middle.
+	state, _ := endgame(rand.New(rand.NewSource(1)), ClassicRules, 26)
+	_, want, ok := solve(context.Background(), state, newTranspositionTable(1<<18))
+	if !ok {
+		t.Fatal("not solved")
+	}
+
+	tt := newTranspositionTable(1 << 18)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, _, ok := solve(ctx, state, tt); ok {
+		t.Skip("solved before the cancel")
+	}
+	pos, _ := NewPosition(state)
+	if entry, ok := tt.probe(newPositionSearch(ctx, pos, tt, &DefaultWeights).key()); ok && entry.depth == solvedDepth {
+		t.Fatalf("the cancelled solve stored a result for the root: %+v", entry)
+	}
+	// What the cancelled solve left in the table doesn't change the proof.
+	_, info, ok := solve(context.Background(), state, tt)
+	if !ok || info.Outcome != want.Outcome || info.Distance != want.Distance {
+		t.Fatalf("solved as %v in %d after a cancelled solve, %v in %d on an empty table", info.Outcome, info.Distance, want.Outcome, want.Distance)
+	}
+}
+
+func TestSearchFallsBackFromSolver(t *testing.T) {
+	// Every position is given to the solver, which can't prove the start in time.
+	engine := alphaBetaEngine{threads: 1, solveThreshold: 81, weights: &DefaultWeights, tt: newTranspositionTable(1 << 18)}
+	state := NewState(ClassicRules)
+	move, info := engine.Search(context.Background(), state, Limits{Time: 50 * time.Millisecond})
+	if info.Proven || info.Depth == 0 {
+		t.Fatalf("info %+v, want a heuristic search", info)
+	}
+	if _, err := PerformMove(state, move); err != nil {
+		t.Fatalf("move %+v: %v", move, err)
+	}
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
 type Player int
 
 const (
@@ -8,87 +14,350 @@ const (
 	None
 )
 
+const (
+	MinBoardSize = 3
+	MaxBoardSize = 5
+	MaxDepth     = 3
+	// maxCells bounds the number of bottom-level cells, which keeps states small enough to send around.
+	maxCells = 729
+)
+
+// Variants change how boards are closed and how the game is decided.
+const (
+	// VariantStandard: being sent to a won or full board lets you play anywhere.
+	VariantStandard = "standard"
+	// VariantOpenWonBoards: a won board stays in play (and can be sent to) until it is full.
+	VariantOpenWonBoards = "open-won-boards"
+	// VariantMajority: a game that ends without a line goes to whoever won more boards.
+	VariantMajority = "majority"
+	// VariantMisere: completing a line of boards loses the game.
+	VariantMisere = "misere"
+)
+
+// Rules describe the geometry of a game: every board has Size x Size cells, Line marks in a row
+// win a board, and boards are nested Depth levels deep (2 is ultimate tic-tac-toe, 3 is
+// "ultimate ultimate"). Variant is one of the Variant constants. Fields left zero take their
+// value from ClassicRules.
+type Rules struct {
+	Size    int    `json:"size" form:"size"`
+	Line    int    `json:"line" form:"line"`
+	Depth   int    `json:"depth" form:"depth"`
+	Variant string `json:"variant" form:"variant"`
+}
+
+var ClassicRules = Rules{Size: 3, Line: 3, Depth: 2, Variant: VariantStandard}
+
+func (this Rules) WithDefaults() Rules {
+	if this.Size == 0 {
+		this.Size = ClassicRules.Size
+	}
+	if this.Line == 0 {
+		this.Line = ClassicRules.Line
+	}
+	if this.Depth == 0 {
+		this.Depth = ClassicRules.Depth
+	}
+	if this.Variant == "" {
+		this.Variant = ClassicRules.Variant
+	}
+	return this
+}
+
+func (this Rules) Validate() error {
+	if this.Size < MinBoardSize || this.Size > MaxBoardSize {
+		return errors.New("Invalid board size")
+	}
+	if this.Line < 3 || this.Line > this.Size {
+		return errors.New("Invalid line length")
+	}
+	if this.Depth < 2 || this.Depth > MaxDepth {
+		return errors.New("Invalid nesting depth")
+	}
+	cells := 1
+	for range this.Depth {
+		cells *= this.Size * this.Size
+	}
+	if cells > maxCells {
+		return errors.New("Board too large")
+	}
+	switch this.Variant {
+	case VariantStandard, VariantOpenWonBoards, VariantMajority, VariantMisere:
+	default:
+		return errors.New("Unknown variant")
+	}
+	return nil
+}
+
+// BoardCount is the number of bottom-level boards; Location indexes them.
+func (this Rules) BoardCount() int {
+	count := 1
+	for range this.Depth - 1 {
+		count *= this.Size * this.Size
+	}
+	return count
+}
+
+func (this Rules) inRange(x int, y int) bool {
+	return x >= 0 && x < this.Size && y >= 0 && y < this.Size
+}
+
+// LocalState is a board at any level. The cells of a bottom-level board hold marks; a board
+// above it holds its nested boards in Boards and who won each of them in Values.
 type LocalState struct {
-	Values [3][3]Player `json:"values"`
-	Winner Player       `json:"winner"`
+	Values [][]Player     `json:"values"`
+	Winner Player         `json:"winner"`
+	Boards [][]LocalState `json:"boards,omitempty"`
 }
+
+// State is a whole game. States share the boards PerformMove didn't change, so they must be
+// treated as immutable.
 type State struct {
-	Values   [3][3]LocalState `json:"values"`
-	ToMove   Player           `json:"to_move"`
-	Location int              `json:"location"`
-	Winner   Player           `json:"winner"`
+	Values   [][]LocalState `json:"values"`
+	ToMove   Player         `json:"to_move"`
+	Location int            `json:"location"`
+	Winner   Player         `json:"winner"`
+	Rules    Rules          `json:"rules"`
 }
 type PlayerGettable interface {
 	Get(a int, b int) Player
 }
 
+func newLocalState(rules Rules, level int) LocalState {
+	local := LocalState{Winner: None, Values: make([][]Player, rules.Size)}
+	for i := range rules.Size {
+		local.Values[i] = make([]Player, rules.Size)
+		for j := range rules.Size {
+			local.Values[i][j] = None
+		}
+	}
+	if level < rules.Depth-1 {
+		local.Boards = make([][]LocalState, rules.Size)
+		for i := range rules.Size {
+			local.Boards[i] = make([]LocalState, rules.Size)
+			for j := range rules.Size {
+				local.Boards[i][j] = newLocalState(rules, level+1)
+			}
+		}
+	}
+	return local
+}
+
+// NewState returns the initial position of a game played with rules.
+func NewState(rules Rules) State {
+	// IMPORTANT: Winner must start as None, otherwise the game is considered already finished
+	// and all moves will be rejected with "Game already finished".
+	state := State{ToMove: Cross, Winner: None, Location: -1, Rules: rules}
+	state.Values = make([][]LocalState, rules.Size)
+	for i := range rules.Size {
+		state.Values[i] = make([]LocalState, rules.Size)
+		for j := range rules.Size {
+			state.Values[i][j] = newLocalState(rules, 1)
+		}
+	}
+	return state
+}
+
+func (this *State) UnmarshalJSON(data []byte) error {
+	type plainState State
+	if err := json.Unmarshal(data, (*plainState)(this)); err != nil {
+		return err
+	}
+	// States stored before rules existed are classic games.
+	this.Rules = this.Rules.WithDefaults()
+	if err := this.Rules.Validate(); err != nil {
+		return err
+	}
+	if !this.validShape() {
+		return errors.New("State does not match its rules")
+	}
+	return nil
+}
+
+// validCell reports whether the player is Cross, Circle or None, the only values a cell or a
+// winner can hold.
+func (this Player) validCell() bool {
+	return this == Cross || this == Circle || this == None
+}
+
+func (this State) validShape() bool {
+	if this.Location < -1 || this.Location >= this.Rules.BoardCount() {
+		return false
+	}
+	if (this.ToMove != Cross && this.ToMove != Circle) || !this.Winner.validCell() {
+		return false
+	}
+	if len(this.Values) != this.Rules.Size {
+		return false
+	}
+	for _, row := range this.Values {
+		if len(row) != this.Rules.Size {
+			return false
+		}
+		for _, local := range row {
+			if !local.validShape(this.Rules, 1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (this LocalState) validShape(rules Rules, level int) bool {
+	if len(this.Values) != rules.Size || !this.Winner.validCell() {
+		return false
+	}
+	for _, row := range this.Values {
+		if len(row) != rules.Size || slices.ContainsFunc(row, func(p Player) bool { return !p.validCell() }) {
+			return false
+		}
+	}
+	if level == rules.Depth-1 {
+		return this.Boards == nil
+	}
+	if len(this.Boards) != rules.Size {
+		return false
+	}
+	for _, row := range this.Boards {
+		if len(row) != rules.Size {
+			return false
+		}
+		for _, local := range row {
+			if !local.validShape(rules, level+1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (this State) Get(a int, b int) Player {
-	if a >= 3 || b >= 3 {
+	if a < 0 || b < 0 || a >= len(this.Values) || b >= len(this.Values[a]) {
 		return None
 	}
 	return this.Values[a][b].Winner
 }
 func (this LocalState) Get(a int, b int) Player {
-	if a >= 3 || b >= 3 {
+	if a < 0 || b < 0 || a >= len(this.Values) || b >= len(this.Values[a]) {
 		return None
 	}
 	return this.Values[a][b]
 }
-func GetWinner(this PlayerGettable) Player {
-	for i := 0; i < 3; i++ {
-		if this.Get(i, 0) != None {
-			yes := true
-			for j := 0; j < 3; j++ {
-				value := this.Get(i, j)
-				if value != this.Get(i, 0) {
-					yes = false
-				}
-			}
-			if yes {
-				return this.Get(i, 0)
+
+// lineDirections are the steps along a row, a column and both diagonals.
+var lineDirections = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// GetWinner returns the player with line marks in a row on a size x size board, or None.
+func GetWinner(this PlayerGettable, size int, line int) Player {
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			first := this.Get(i, j)
+			if first == None {
+				continue
 			}
-		}
-		if this.Get(0, i) != None {
-			yes := true
-			for j := 0; j < 3; j++ {
-				if this.Get(j, i) != this.Get(0, i) {
-					yes = false
+			for _, d := range lineDirections {
+				endX, endY := i+d[0]*(line-1), j+d[1]*(line-1)
+				if endX < 0 || endX >= size || endY < 0 || endY >= size {
+					continue
+				}
+				yes := true
+				for k := 1; k < line; k++ {
+					if this.Get(i+d[0]*k, j+d[1]*k) != first {
+						yes = false
+						break
+					}
+				}
+				if yes {
+					return first
 				}
-			}
-			if yes {
-				return this.Get(0, i)
 			}
 		}
 	}
-	yes := true
-	if this.Get(0, 0) != None {
-		for i := 0; i < 3; i++ {
-			if this.Get(i, i) != this.Get(0, 0) {
-				yes = false
-				break
+	return None
+}
+func (this *LocalState) Update(line int) {
+	this.Winner = GetWinner(this, len(this.Values), line)
+}
+func (this *State) Update() {
+	this.Winner = GetWinner(this, this.Rules.Size, this.Rules.Line)
+	if this.Winner != None && this.Rules.Variant == VariantMisere {
+		this.Winner = 1 - this.Winner
+	}
+	if this.Winner == None && this.Rules.Variant == VariantMajority && this.IsOver() {
+		this.Winner = this.majority()
+	}
+}
+
+// majority returns the player who won more of the outermost boards, or None on a tie.
+func (this State) majority() Player {
+	won := [2]int{}
+	for i := range this.Values {
+		for j := range this.Values[i] {
+			if winner := this.Get(i, j); winner != None {
+				won[winner]++
 			}
 		}
-		if yes {
-			return this.Get(0, 0)
-		}
 	}
-	yes = true
-	if this.Get(2, 0) != None {
-		for i := 0; i < 3; i++ {
-			if this.Get(2-i, i) != this.Get(2, 0) {
-				yes = false
-				break
+	switch {
+	case won[Cross] > won[Circle]:
+		return Cross
+	case won[Circle] > won[Cross]:
+		return Circle
+	}
+	return None
+}
+
+func (this LocalState) HasEmpty() bool {
+	for _, row := range this.Values {
+		for _, value := range row {
+			if value == None {
+				return true
 			}
 		}
-		if yes {
-			return this.Get(2, 0)
-		}
 	}
-	return None
+	return false
 }
-func (this *LocalState) Update() {
-	this.Winner = GetWinner(this)
+
+// boardPath splits a Location-style board index into the cell picked at every level above the
+// bottom one, outermost first.
+func (this Rules) boardPath(index int) [MaxDepth][2]int {
+	var path [MaxDepth][2]int
+	cells := this.Size * this.Size
+	for level := this.Depth - 2; level >= 0; level-- {
+		cell := index % cells
+		index /= cells
+		path[level] = [2]int{cell / this.Size, cell % this.Size}
+	}
+	return path
 }
-func (this *State) Update() {
-	this.Winner = GetWinner(this)
+
+// Board returns the bottom-level board with the given index and whether it and every board
+// containing it are still undecided, which only matters outside VariantOpenWonBoards.
+func (this State) Board(index int) (*LocalState, bool) {
+	path := this.Rules.boardPath(index)
+	local := &this.Values[path[0][0]][path[0][1]]
+	open := local.Winner == None
+	for level := 1; level < this.Rules.Depth-1; level++ {
+		local = &local.Boards[path[level][0]][path[level][1]]
+		open = open && local.Winner == None
+	}
+	return local, open || this.Rules.Variant == VariantOpenWonBoards
+}
+
+// Playable reports whether a move can still be made on the bottom-level board with the given index.
+func (this State) Playable(index int) bool {
+	local, open := this.Board(index)
+	return open && local.HasEmpty()
+}
+
+// IsOver reports whether the game has a winner or no move can be made anymore.
+func (this State) IsOver() bool {
+	if this.Winner != None {
+		return true
+	}
+	for index := range this.Rules.BoardCount() {
+		if this.Playable(index) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ttEntries is the size of the transposition table (16 bytes each).
+const ttEntries = 1 << 20
+
+type bound uint8
+
+const (
+	boundExact bound = iota + 1
+	boundLower       // the score is at least the stored one (it caused a beta cutoff)
+	boundUpper       // the score is at most the stored one (no move raised alpha)
+)
+
+type ttEntry struct {
+	score int
+	depth int
+	bound bound
+	move  bitMove
+}
+
+// ttSlot stores an entry packed into data, and the position hash XOR data in key: a slot torn by
+// concurrent writers fails the key check on probe instead of returning a wrong entry.
+type ttSlot struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+// transpositionTable remembers search results by position hash. It is fixed-size, always
+// replaces entries of other positions, and is safe for concurrent searches without locks.
+type transpositionTable struct {
+	slots []ttSlot
+	mask  uint64
+}
+
+func newTranspositionTable(entries int) *transpositionTable {
+	return &transpositionTable{slots: make([]ttSlot, entries), mask: uint64(entries - 1)}
+}
+
+var (
+	sharedTTOnce sync.Once
+	sharedTTable *transpositionTable
+)
+
+// sharedTT is the table the bot's searches share, so that later moves of a game and concurrent
+// games reuse each other's results. It is allocated on first use.
+func sharedTT() *transpositionTable {
+	sharedTTOnce.Do(func() {
+		sharedTTable = newTranspositionTable(ttEntries)
+	})
+	return sharedTTable
+}
+
+// clear empties the table; it must not run during a search.
+func (this *transpositionTable) clear() {
+	clear(this.slots)
+}
+
+const ttValid = 1 << 56
+
+func packEntry(entry ttEntry) uint64 {
+	return uint64(uint32(int32(entry.score))) | uint64(uint8(entry.depth))<<32 | uint64(entry.bound)<<40 |
+		uint64(entry.move)<<48 | ttValid
+}
+
+func unpackEntry(data uint64) ttEntry {
+	return ttEntry{
+		score: int(int32(uint32(data))),
+		depth: int(int8(uint8(data >> 32))),
+		bound: bound(data >> 40),
+		move:  bitMove(data >> 48),
+	}
+}
+
+func (this *transpositionTable) probe(hash uint64) (ttEntry, bool) {
+	slot := &this.slots[hash&this.mask]
+	data := slot.data.Load()
+	if data&ttValid == 0 || slot.key.Load()^data != hash {
+		return ttEntry{}, false
+	}
+	return unpackEntry(data), true
+}
+
+// store keeps the deeper result when the slot already holds the same position.
+func (this *transpositionTable) store(hash uint64, entry ttEntry) {
+	slot := &this.slots[hash&this.mask]
+	old := slot.data.Load()
+	if old&ttValid != 0 && slot.key.Load()^old == hash && unpackEntry(old).depth > entry.depth {
+		return
+	}
+	data := packEntry(entry)
+	slot.key.Store(hash ^ data)
+	slot.data.Store(data)
+}
+
+// Mate scores count plies from the root, but a table entry may be reached at another ply:
+// the table stores them counted from the entry's own position instead.
+func scoreToTT(score int, ply int) int {
+	if score > abInf-2*maxPly {
+		return score + ply
+	}
+	if score < -(abInf - 2*maxPly) {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score int, ply int) int {
+	if score > abInf-2*maxPly {
+		return score - ply
+	}
+	if score < -(abInf - 2*maxPly) {
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTranspositionTableRoundTrip(t *testing.T) {
+	tt := newTranspositionTable(1 << 4)
+	entries := []ttEntry{
+		{score: 0, depth: 1, bound: boundExact, move: 0},
+		{score: -123, depth: 7, bound: boundUpper, move: 80},
+		{score: abInf - 5, depth: solvedDepth, bound: boundLower, move: 40},
+		{score: -(abInf - 9), depth: 60, bound: boundExact, move: 12},
+	}
+	for i, entry := range entries {
+		hash := uint64(i+1) * 0x9e3779b97f4a7c15
+		tt.store(hash, entry)
+		got, ok := tt.probe(hash)
+		if !ok || got != entry {
+			t.Fatalf("stored %+v, probed %+v (%v)", entry, got, ok)
+		}
+		// Another position in the same slot misses.
+		if _, ok := tt.probe(hash ^ 1<<40); ok {
+			t.Fatalf("probe of another position found %+v", entry)
+		}
+	}
+
+	// Shallower results for the same position don't replace deeper ones, other positions do.
+	hash := uint64(0xabcdef00)
+	tt.store(hash, ttEntry{score: 5, depth: 6, bound: boundExact, move: 3})
+	tt.store(hash, ttEntry{score: 9, depth: 2, bound: boundExact, move: 4})
+	if got, _ := tt.probe(hash); got.depth != 6 {
+		t.Fatalf("a shallower entry replaced the deeper one: %+v", got)
+	}
+	tt.store(hash^1<<50, ttEntry{score: 9, depth: 2, bound: boundExact, move: 4})
+	if _, ok := tt.probe(hash); ok {
+		t.Fatal("the replaced position is still found")
+	}
+
+	tt.clear()
+	if _, ok := tt.probe(hash ^ 1<<50); ok {
+		t.Fatal("found an entry after clear")
+	}
+}
+
+// entryFor is the entry concurrent writers store for hash, so readers can check what they find.
+func entryFor(hash uint64) ttEntry {
+	return ttEntry{score: int(int16(hash >> 20)), depth: int(hash>>40) % 64, bound: bound(hash>>50)%3 + 1, move: bitMove(hash>>54) % 81}
+}
+
+func TestTranspositionTableConcurrentWrites(t *testing.T) {
+	// Every writer hits the same slot with its own positions, so slots are torn all the time.
+	tt := newTranspositionTable(1)
+	var wg sync.WaitGroup
+	for writer := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20000 {
+				hash := (uint64(writer)<<32 | uint64(i)) * 0x9e3779b97f4a7c15
+				tt.store(hash, entryFor(hash))
+				if got, ok := tt.probe(hash); ok && got != entryFor(hash) {
+					t.Errorf("probed %+v for %x, which stored %+v", got, hash, entryFor(hash))
+					return
+				}
+				// Any position found must come with its own entry.
+				other := (uint64(writer+1)%8<<32 | uint64(i)) * 0x9e3779b97f4a7c15
+				if got, ok := tt.probe(other); ok && got != entryFor(other) {
+					t.Errorf("probed %+v for %x, which stored %+v", got, other, entryFor(other))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
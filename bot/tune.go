@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// TuneOptions controls Tune.
+type TuneOptions struct {
+	Variant      string
+	Games        int // self-play games the positions are taken from
+	Depth        int // the search depth of the self-play moves
+	OpeningPlies int // random moves each game starts with
+	Epochs       int // gradient descent steps over all positions
+	Rate         float64
+	Concurrency  int // games played at once
+	Seed         int64
+	Weights      Weights // the weights the games are played with, and tuning starts from
+}
+
+// tuneSample is a position of a self-play game: its features and the game's result, both for
+// Cross (1 a win, 0.5 a draw, 0 a loss).
+type tuneSample struct {
+	features [numFeatures]float64
+	result   float64
+}
+
+// TuneResult reports on a tuning run; the errors are the mean squared differences between the
+// results and the win probabilities the weights predict.
+type TuneResult struct {
+	Weights     Weights
+	Positions   int
+	K           float64 // scales evaluations to win probabilities: 1 / (1 + e^(-K*eval))
+	ErrorBefore float64
+	ErrorAfter  float64
+}
+
+// Tune fits the evaluation weights Texel-style: it plays self-play games, then fits the weights
+// by gradient descent so that a logistic function of each position's evaluation predicts the
+// game's result. The result only depends on options, not on timing or the number of goroutines.
+func Tune(ctx context.Context, options TuneOptions) (TuneResult, error) {
+	samples, err := tuneSamples(ctx, options)
+	if err != nil {
+		return TuneResult{}, err
+	}
+	if len(samples) == 0 {
+		return TuneResult{}, fmt.Errorf("the self-play games have no positions")
+	}
+	var weights [numFeatures]float64
+	for i, weight := range options.Weights {
+		weights[i] = float64(weight)
+	}
+	// K is fitted to the starting weights and then kept, which fixes the scale of the tuned ones.
+	k := fitK(samples, weights)
+	result := TuneResult{Positions: len(samples), K: k, ErrorBefore: tuneError(samples, weights, k)}
+
+	// Adam keeps the step size sensible for features as rare as a free move and as common as a
+	// local threat.
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+	var m, v [numFeatures]float64
+	for epoch := 1; epoch <= options.Epochs; epoch++ {
+		if ctx.Err() != nil {
+			return TuneResult{}, ctx.Err()
+		}
+		gradient := tuneGradient(samples, weights, k)
+		for i := range numFeatures {
+			m[i] = beta1*m[i] + (1-beta1)*gradient[i]
+			v[i] = beta2*v[i] + (1-beta2)*gradient[i]*gradient[i]
+			mHat := m[i] / (1 - math.Pow(beta1, float64(epoch)))
+			vHat := v[i] / (1 - math.Pow(beta2, float64(epoch)))
+			weights[i] -= options.Rate * mHat / (math.Sqrt(vHat) + epsilon)
+		}
+	}
+	for i, weight := range weights {
+		result.Weights[i] = int(math.Round(weight))
+		weights[i] = float64(result.Weights[i])
+	}
+	result.ErrorAfter = tuneError(samples, weights, k)
+	return result, nil
+}
+
+// tuneSamples plays the self-play games, each with its own transposition table so that its moves
+// don't depend on the other games.
+func tuneSamples(ctx context.Context, options TuneOptions) ([]tuneSample, error) {
+	rules := ClassicRules
+	rules.Variant = options.Variant
+	games := make(chan int, options.Games)
+	for game := range options.Games {
+		games <- game
+	}
+	close(games)
+	perGame := make([][]tuneSample, options.Games)
+	var wg sync.WaitGroup
+	for range max(options.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tt := newTranspositionTable(ttEntries)
+			for game := range games {
+				if ctx.Err() != nil {
+					return
+				}
+				tt.clear()
+				rng := rand.New(rand.NewSource(options.Seed + int64(game)))
+				perGame[game] = playTuneGame(ctx, arenaOpening(rules, options.OpeningPlies, rng), tt, options)
+			}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var samples []tuneSample
+	for _, game := range perGame {
+		samples = append(samples, game...)
+	}
+	return samples, nil
+}
+
+func playTuneGame(ctx context.Context, state State, tt *transpositionTable, options TuneOptions) []tuneSample {
+	var samples []tuneSample
+	for !state.IsOver() {
+		pos, _ := NewPosition(state)
+		var sample tuneSample
+		for i, count := range pos.features(Cross) {
+			sample.features[i] = float64(count)
+		}
+		samples = append(samples, sample)
+
+		move, _, ok := newPositionSearch(ctx, pos, tt, &options.Weights).bestMove(options.Depth)
+		if !ok {
+			break
+		}
+		state, _ = PerformMove(state, move)
+	}
+	result := 0.5
+	switch state.Winner {
+	case Cross:
+		result = 1
+	case Circle:
+		result = 0
+	}
+	for i := range samples {
+		samples[i].result = result
+	}
+	return samples
+}
+
+func tuneEval(sample *tuneSample, weights [numFeatures]float64) float64 {
+	eval := 0.0
+	for i, weight := range weights {
+		eval += weight * sample.features[i]
+	}
+	return eval
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func tuneError(samples []tuneSample, weights [numFeatures]float64, k float64) float64 {
+	sum := 0.0
+	for i := range samples {
+		diff := samples[i].result - sigmoid(k*tuneEval(&samples[i], weights))
+		sum += diff * diff
+	}
+	return sum / float64(len(samples))
+}
+
+func tuneGradient(samples []tuneSample, weights [numFeatures]float64, k float64) [numFeatures]float64 {
+	var gradient [numFeatures]float64
+	for i := range samples {
+		p := sigmoid(k * tuneEval(&samples[i], weights))
+		factor := -2 * (samples[i].result - p) * p * (1 - p) * k
+		for j := range numFeatures {
+			gradient[j] += factor * samples[i].features[j]
+		}
+	}
+	for j := range gradient {
+		gradient[j] /= float64(len(samples))
+	}
+	return gradient
+}
+
+// fitK finds the scale that best predicts the results with the given weights, by golden section
+// search (the error is unimodal in K).
+func fitK(samples []tuneSample, weights [numFeatures]float64) float64 {
+	low, high := 0.0, 2.0
+	ratio := (math.Sqrt(5) - 1) / 2
+	for range 100 {
+		a := high - ratio*(high-low)
+		b := low + ratio*(high-low)
+		if tuneError(samples, weights, a) < tuneError(samples, weights, b) {
+			high = b
+		} else {
+			low = a
+		}
+	}
+	return (low + high) / 2
+}
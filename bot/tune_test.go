@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTuneDeterministic(t *testing.T) {
+	options := TuneOptions{Variant: VariantStandard, Games: 8, Depth: 2, OpeningPlies: 4, Epochs: 50, Rate: 0.5,
+		Concurrency: 1, Seed: 7, Weights: DefaultWeights}
+	first, err := Tune(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Positions == 0 || first.Weights == DefaultWeights {
+		t.Fatalf("tuned %d positions to %v", first.Positions, first.Weights)
+	}
+
+	// The same seed gives the same weights, however many games are played at once.
+	options.Concurrency = 4
+	second, err := Tune(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("tuned %+v, then %+v with the same seed", first, second)
+	}
+
+	options.Seed++
+	if other, err := Tune(context.Background(), options); err != nil || other == first {
+		t.Fatalf("tuned %+v with another seed (%v)", other, err)
+	}
+}
+
+func TestTuneCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Tune(ctx, TuneOptions{Variant: VariantStandard, Games: 2, Depth: 2, Epochs: 1, Rate: 1, Weights: DefaultWeights}); err == nil {
+		t.Fatal("tuned with a cancelled context")
+	}
+}
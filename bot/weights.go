@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+)
+
+// The evaluation of a classic geometry position is a weighted sum of features, each counted as
+// the player's minus the opponent's (or, for the features of the side to move, positive when the
+// player is to move).
+const (
+	featureWonBoard     = iota // local boards won
+	featureCenterBoard         // the center local board won
+	featureCornerBoard         // corner local boards won
+	featureGlobalThreat        // lines of won boards one board short (negated in misère)
+	featureLocalThreat         // lines in undecided local boards one mark short
+	featureCenterCell          // center cells of undecided local boards
+	featureForcedThreat        // threats of the side to move in the board it is sent to
+	featureFreeMove            // the side to move was sent to a won or full board and plays anywhere
+	numFeatures
+)
+
+var featureNames = [numFeatures]string{
+	featureWonBoard:     "wonBoard",
+	featureCenterBoard:  "centerBoard",
+	featureCornerBoard:  "cornerBoard",
+	featureGlobalThreat: "globalThreat",
+	featureLocalThreat:  "localThreat",
+	featureCenterCell:   "centerCell",
+	featureForcedThreat: "forcedThreat",
+	featureFreeMove:     "freeMove",
+}
+
+// Weights weigh the evaluation features; in JSON they are an object keyed by feature name.
+type Weights [numFeatures]int
+
+// DefaultWeights is the evaluation the bot was written with: 8 per won board and per line of
+// won boards one short, 1 per local line one short.
+var DefaultWeights = Weights{
+	featureWonBoard:     wonBoardWeight,
+	featureGlobalThreat: wonBoardWeight,
+	featureLocalThreat:  1,
+}
+
+// key hashes the weights; it is zero for DefaultWeights.
+func (this *Weights) key() uint64 {
+	if *this == DefaultWeights {
+		return 0
+	}
+	key := uint64(0)
+	for _, weight := range this {
+		key += uint64(weight)
+		key = splitmix64(&key)
+	}
+	return key
+}
+
+func (this Weights) MarshalJSON() ([]byte, error) {
+	named := make(map[string]int, numFeatures)
+	for i, name := range featureNames {
+		named[name] = this[i]
+	}
+	return json.Marshal(named)
+}
+
+// UnmarshalJSON sets the weights named in the object; the others keep their value.
+func (this *Weights) UnmarshalJSON(data []byte) error {
+	var named map[string]int
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	for name, weight := range named {
+		i := featureIndex(name)
+		if i < 0 {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		this[i] = weight
+	}
+	return nil
+}
+
+func featureIndex(name string) int {
+	for i, featureName := range featureNames {
+		if featureName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadWeights reads a weights file; features it doesn't name keep their default weight.
+func LoadWeights(path string) (Weights, error) {
+	weights := DefaultWeights
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return weights, err
+	}
+	err = json.Unmarshal(data, &weights)
+	return weights, err
+}
+
+const (
+	centerBoard  = 1 << 4
+	cornerBoards = 1<<0 | 1<<2 | 1<<6 | 1<<8
+)
+
+// features counts the features of a position without a winner from player's perspective.
+func (this *Position) features(player Player) [numFeatures]int {
+	var f [numFeatures]int
+	mine, theirs := this.won[player], this.won[1-player]
+	f[featureWonBoard] = bits.OnesCount16(mine) - bits.OnesCount16(theirs)
+	f[featureCenterBoard] = bits.OnesCount16(mine&centerBoard) - bits.OnesCount16(theirs&centerBoard)
+	f[featureCornerBoard] = bits.OnesCount16(mine&cornerBoards) - bits.OnesCount16(theirs&cornerBoards)
+	f[featureGlobalThreat] = threats(mine, theirs)
+	if this.variant == VariantMisere {
+		// Lines of won boards lose in misère.
+		f[featureGlobalThreat] = -f[featureGlobalThreat]
+	}
+	for b := range 9 {
+		if (mine|theirs)&(1<<b) != 0 {
+			continue
+		}
+		f[featureLocalThreat] += threats(this.cells[player][b], this.cells[1-player][b])
+		f[featureCenterCell] += int(this.cells[player][b]>>4&1) - int(this.cells[1-player][b]>>4&1)
+	}
+
+	sign := 1
+	if this.toMove != player {
+		sign = -1
+	}
+	if this.forced == -1 {
+		f[featureFreeMove] = sign
+	} else {
+		b := this.forced
+		f[featureForcedThreat] = sign * threats(this.cells[this.toMove][b], this.cells[1-this.toMove][b])
+	}
+	return f
+}
+
+// evaluate is EvaluateFor on a Position, with the given weights.
+func (this *Position) evaluate(player Player, weights *Weights) int {
+	if this.winner == player {
+		return abInf
+	}
+	if this.winner == 1-player {
+		return -abInf
+	}
+	f := this.features(player)
+	answer := 0
+	for i, weight := range weights {
+		answer += weight * f[i]
+	}
+	return answer
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadWeights(t *testing.T) {
+	partial := DefaultWeights
+	partial[featureCenterCell] = 3
+	partial[featureWonBoard] = -2
+
+	tests := []struct {
+		name  string
+		text  string
+		want  Weights
+		fails bool
+	}{
+		{"empty", `{}`, DefaultWeights, false},
+		// Features left out keep their default weight.
+		{"some features", `{"centerCell":3,"wonBoard":-2}`, partial, false},
+		{"unknown feature", `{"centerCell":3,"edgeCell":1}`, Weights{}, true},
+		{"not a number", `{"centerCell":"3"}`, Weights{}, true},
+		{"not an object", `[1,2,3]`, Weights{}, true},
+		{"malformed", `{"centerCell":3`, Weights{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "weights.json")
+			if err := os.WriteFile(path, []byte(test.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			weights, err := LoadWeights(path)
+			if (err != nil) != test.fails {
+				t.Fatalf("error %v", err)
+			}
+			if !test.fails && weights != test.want {
+				t.Fatalf("loaded %v, want %v", weights, test.want)
+			}
+		})
+	}
+
+	if _, err := LoadWeights(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("loaded a missing file")
+	}
+}
+
+func TestWeightsRoundTrip(t *testing.T) {
+	var weights Weights
+	for i := range weights {
+		weights[i] = i*7 - 20
+	}
+	text, err := json.Marshal(weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Weights
+	if err := json.Unmarshal(text, &read); err != nil {
+		t.Fatal(err)
+	}
+	if read != weights {
+		t.Fatalf("%s read back as %v, want %v", text, read, weights)
+	}
+	// The table keeps the results of different weights apart by their key.
+	other := weights
+	other[0]++
+	if DefaultWeights.key() != 0 || weights.key() == 0 || weights.key() == other.key() {
+		t.Fatal("weights keys don't tell weights apart")
+	}
+}
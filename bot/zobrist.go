@@ -0,0 +1,64 @@
+package main
+
+// Zobrist keys: the hash of a Position identifies it in the transposition table, so positions
+// reached by different move orders share their search results. It is the XOR of the keys of its
+// marks and won boards, of the side to move (when it is Circle), of the forced board and of the
+// variant, which Make and Unmake update one move at a time. Won boards need their own keys
+// because with open won boards the first winner depends on the move order.
+var (
+	zobristCells   [2][81]uint64
+	zobristWon     [2][9]uint64
+	zobristSide    uint64
+	zobristForced  [10]uint64 // indexed by forced+1, so a free move has a key too
+	zobristVariant = map[string]uint64{}
+)
+
+// splitmix64 generates the keys; a fixed seed gives the same hashes in every run, so searches
+// repeat exactly and the opening book (book.go), which is keyed by them, stays valid.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func init() {
+	seed := uint64(0x7474742d626f7421)
+	for player := range 2 {
+		for cell := range 81 {
+			zobristCells[player][cell] = splitmix64(&seed)
+		}
+		for b := range 9 {
+			zobristWon[player][b] = splitmix64(&seed)
+		}
+	}
+	zobristSide = splitmix64(&seed)
+	for i := range zobristForced {
+		zobristForced[i] = splitmix64(&seed)
+	}
+	for _, variant := range []string{VariantStandard, VariantOpenWonBoards, VariantMajority, VariantMisere} {
+		zobristVariant[variant] = splitmix64(&seed)
+	}
+}
+
+// computeHash hashes a position from scratch; Make and Unmake keep it up to date incrementally.
+func (this *Position) computeHash() uint64 {
+	hash := zobristVariant[this.variant] ^ zobristForced[this.forced+1]
+	if this.toMove == Circle {
+		hash ^= zobristSide
+	}
+	for player := range 2 {
+		for b := range 9 {
+			if this.won[player]&(1<<b) != 0 {
+				hash ^= zobristWon[player][b]
+			}
+			for c := range 9 {
+				if this.cells[player][b]&(1<<c) != 0 {
+					hash ^= zobristCells[player][b*9+c]
+				}
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIncrementalHash(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, variant := range []string{VariantStandard, VariantMajority, VariantMisere} {
+		rules := ClassicRules
+		rules.Variant = variant
+		for game := range 20 {
+			pos, _ := NewPosition(NewState(rules))
+			hashes := []uint64{pos.hash}
+			for pos.winner == None {
+				moves := pos.Moves(nil)
+				if len(moves) == 0 {
+					break
+				}
+				// Now and then take a few moves back and play on from there.
+				if len(hashes) > 4 && rng.Intn(8) == 0 {
+					for range rng.Intn(4) + 1 {
+						pos.Unmake()
+						hashes = hashes[:len(hashes)-1]
+						if pos.hash != hashes[len(hashes)-1] {
+							t.Fatalf("%s game %d: hash after Unmake differs from before Make", variant, game)
+						}
+					}
+					continue
+				}
+				pos.Make(moves[rng.Intn(len(moves))])
+				if pos.hash != pos.computeHash() {
+					t.Fatalf("%s game %d ply %d: incremental hash %x, from scratch %x", variant, game, len(hashes), pos.hash, pos.computeHash())
+				}
+				if state, _ := NewPosition(pos.State()); state.hash != pos.hash {
+					t.Fatalf("%s game %d ply %d: hash of the converted state differs", variant, game, len(hashes))
+				}
+				hashes = append(hashes, pos.hash)
+			}
+		}
+	}
+}
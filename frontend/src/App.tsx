@@ -1,41 +1,69 @@
 import React, { useEffect, useLayoutEffect, useMemo, useRef, useState } from "react";
 import { findMatch, getState, makeMove } from "./api";
-import type { MyState, Player, State } from "./types";
+import type { LocalState, MyState, Player, Rules, State, Variant } from "./types";
 import { playerLabel } from "./types";
 
-function isPlayableBoard(localWinner: Player): boolean {
-  return localWinner === 2; // only if LocalState.winner == None
+// Boards to pick from when looking for a match; players are only paired with the same board.
+const BOARDS: { label: string; rules: Pick<Rules, "size" | "line" | "depth"> }[] = [
+  { label: "Classic 3x3", rules: { size: 3, line: 3, depth: 2 } },
+  { label: "4x4, 3 in a row", rules: { size: 4, line: 3, depth: 2 } },
+  { label: "4x4, 4 in a row", rules: { size: 4, line: 4, depth: 2 } },
+  { label: "5x5, 4 in a row", rules: { size: 5, line: 4, depth: 2 } },
+  { label: "5x5, 5 in a row", rules: { size: 5, line: 5, depth: 2 } },
+  { label: "Ultimate ultimate (3 levels)", rules: { size: 3, line: 3, depth: 3 } },
+];
+
+const VARIANTS: { label: string; variant: Variant }[] = [
+  { label: "Sent to a closed board: play anywhere", variant: "standard" },
+  { label: "Won boards stay open until full", variant: "open-won-boards" },
+  { label: "Most boards won decides a draw", variant: "majority" },
+  { label: "Misère: a line of boards loses", variant: "misere" },
+];
+
+// A board path is the cell picked at every level above the bottom boards, outermost first.
+type BoardPath = [number, number][];
+
+function boardPath(rules: Rules, index: number): BoardPath {
+  const cells = rules.size * rules.size;
+  const path: BoardPath = [];
+  for (let level = 0; level < rules.depth - 1; level++) {
+    const cell = index % cells;
+    index = Math.floor(index / cells);
+    path.unshift([Math.floor(cell / rules.size), cell % rules.size]);
+  }
+  return path;
 }
 
-function allowedBoardFromLocation(location: number): { bx: number; by: number } | null {
-  if (location === -1) return null;
-  return { bx: Math.floor(location / 3), by: location % 3 };
+function samePath(a: BoardPath, b: BoardPath): boolean {
+  return a.every(([x, y], i) => b[i][0] === x && b[i][1] === y);
 }
 
-function hasAnyLegalMove(state: State): boolean {
-  // If a sub-board is forced, you must play there unless it's already won.
-  const forced = allowedBoardFromLocation(state.location);
-
-  const canPlayInBoard = (bx: number, by: number) => {
-    const local = state.values[bx][by];
-    if (!isPlayableBoard(local.winner)) return false;
-    for (let cx = 0; cx < 3; cx++) {
-      for (let cy = 0; cy < 3; cy++) {
-        if (local.values[cx][cy] === 2) return true;
-      }
-    }
-    return false;
-  };
+function pathLabel(path: BoardPath): string {
+  return path.map(([x, y]) => `${x + 1},${y + 1}`).join(" / ");
+}
 
-  if (forced) {
-    if (canPlayInBoard(forced.bx, forced.by)) return true;
+// bottomBoard returns the bottom-level board at path and whether it and every board containing it
+// are undecided, which only matters outside the open-won-boards variant.
+function bottomBoard(state: State, path: BoardPath): { local: LocalState; open: boolean } {
+  let local = state.values[path[0][0]][path[0][1]];
+  let open = local.winner === 2;
+  for (const [x, y] of path.slice(1)) {
+    local = local.boards![x][y];
+    open = open && local.winner === 2;
   }
+  return { local, open: open || state.rules.variant === "open-won-boards" };
+}
 
-  // Otherwise any non-won board with an empty cell is legal.
-  for (let bx = 0; bx < 3; bx++) {
-    for (let by = 0; by < 3; by++) {
-      if (canPlayInBoard(bx, by)) return true;
-    }
+function isPlayableBoard(state: State, path: BoardPath): boolean {
+  const { local, open } = bottomBoard(state, path);
+  return open && local.values.some((row) => row.some((cell) => cell === 2));
+}
+
+function hasAnyLegalMove(state: State): boolean {
+  // A forced board is always playable, so any playable board means there is a legal move.
+  const count = Math.pow(state.rules.size * state.rules.size, state.rules.depth - 1);
+  for (let index = 0; index < count; index++) {
+    if (isPlayableBoard(state, boardPath(state.rules, index))) return true;
   }
   return false;
 }
@@ -50,6 +78,8 @@ export function App() {
   const [session, setSession] = useState<MyState | null>(null);
   const [state, setState] = useState<State | null>(null);
   const [status, setStatus] = useState<"idle" | "matching" | "playing">("idle");
+  const [board, setBoard] = useState<number>(0); // index in BOARDS
+  const [variant, setVariant] = useState<Variant>("standard");
   const [error, setError] = useState<string | null>(null);
   const [boardSizePx, setBoardSizePx] = useState<number>(0);
 
@@ -63,7 +93,10 @@ export function App() {
   const toMove = state?.to_move ?? 2;
   const itsMyTurn = status === "playing" && myRole !== 2 && toMove === myRole;
 
-  const allowedBoard = useMemo(() => (state ? allowedBoardFromLocation(state.location) : null), [state]);
+  const allowedBoard = useMemo(
+    () => (state && state.location !== -1 ? boardPath(state.rules, state.location) : null),
+    [state],
+  );
   const isDraw = useMemo(() => {
     if (!state) return false;
     if (state.winner !== 2) return false;
@@ -100,7 +133,7 @@ export function App() {
     matchAbortRef.current = ac;
 
     try {
-      const ms = await findMatch(ac.signal);
+      const ms = await findMatch({ ...BOARDS[board].rules, variant }, ac.signal);
       setSession(ms);
       setState(ms.game_state);
       setStatus("playing");
@@ -119,7 +152,7 @@ export function App() {
     setStatus("idle");
   }
 
-  // Ensure the full 3x3 board always fits on screen: compute a square size from available board area.
+  // Ensure the full board always fits on screen: compute a square size from available board area.
   useLayoutEffect(() => {
     if (status !== "playing") return;
     const el = boardAreaRef.current;
@@ -192,24 +225,24 @@ export function App() {
     };
   }, [status, gameId, myRole]);
 
-  async function onClickCell(bx: number, by: number, cx: number, cy: number) {
+  async function onClickCell(path: BoardPath, cx: number, cy: number) {
     if (!state || !session || !gameId) return;
     if (!itsMyTurn) return;
     if (gameEnded) return;
 
     // Enforce allowed board: if location != -1, you must play in that board.
-    if (allowedBoard && (allowedBoard.bx !== bx || allowedBoard.by !== by)) return;
+    if (allowedBoard && !samePath(allowedBoard, path)) return;
 
-    const local = state.values[bx][by];
-    if (!isPlayableBoard(local.winner)) return;
-    if (local.values[cx][cy] !== 2) return;
+    if (!isPlayableBoard(state, path)) return;
+    if (bottomBoard(state, path).local.values[cx][cy] !== 2) return;
 
     setError(null);
     try {
       const next = await makeMove(gameId, {
         player: session.role,
-        cellX: bx,
-        cellY: by,
+        cellX: path[0][0],
+        cellY: path[0][1],
+        ...(path.length > 1 ? { midX: path[1][0], midY: path[1][1] } : {}),
         finalX: cx,
         finalY: cy,
       });
@@ -226,6 +259,64 @@ export function App() {
     }
   }
 
+  // renderBoards lays out the boards nested in one board; path leads to that board.
+  function renderBoards(boards: LocalState[][], path: BoardPath): React.ReactNode {
+    if (!state) return null;
+    const bottom = path.length === state.rules.depth - 2;
+    return boards.map((row, bx) =>
+      row.map((local, by) => {
+        const here: BoardPath = [...path, [bx, by]];
+        const key = pathLabel(here);
+        if (!bottom) {
+          return (
+            <div key={key} className={"midBoard" + (local.winner !== 2 ? " localBoard-locked" : "")}>
+              <div className="localTop">
+                <div className="localLabel">{bx + 1},{by + 1}</div>
+                <div className="localWinner">{local.winner !== 2 ? `Winner: ${playerLabel(local.winner)}` : ""}</div>
+              </div>
+              <div className="midGrid">{renderBoards(local.boards!, here)}</div>
+            </div>
+          );
+        }
+        const forced = allowedBoard ? samePath(allowedBoard, here) : true;
+        const playable = isPlayableBoard(state, here);
+        const boardClass =
+          "localBoard" +
+          (forced ? " localBoard-forced" : "") +
+          (playable ? "" : " localBoard-locked");
+        return (
+          <div key={key} className={boardClass}>
+            {state.rules.depth === 2 ? (
+              <div className="localTop">
+                <div className="localLabel">
+                  {bx + 1},{by + 1}
+                </div>
+                <div className="localWinner">
+                  {local.winner !== 2 ? `Winner: ${playerLabel(local.winner)}` : ""}
+                </div>
+              </div>
+            ) : null}
+            <div className="localGrid">
+              {local.values.map((cellsRow, cx) =>
+                cellsRow.map((cell, cy) => (
+                  <button
+                    key={`${key}-${cx}-${cy}`}
+                    className={cellBg(cell)}
+                    onClick={() => void onClickCell(here, cx, cy)}
+                    disabled={gameEnded || !itsMyTurn || cell !== 2 || !playable || (!!allowedBoard && !forced)}
+                    title={`Board ${key} • Cell ${cx + 1},${cy + 1}`}
+                  >
+                    {playerLabel(cell)}
+                  </button>
+                )),
+              )}
+            </div>
+          </div>
+        );
+      }),
+    );
+  }
+
   const headline = useMemo(() => {
     if (status === "matching") return "Finding match…";
     if (status === "idle") return "Ultimate Tic-Tac-Toe";
@@ -233,7 +324,14 @@ export function App() {
   }, [status]);
 
   return (
-    <div className="page" style={{ ["--boardSize" as any]: `${boardSizePx}px` }}>
+    <div
+      className="page"
+      style={{
+        ["--boardSize" as any]: `${boardSizePx}px`,
+        ["--size" as any]: state?.rules.size ?? 3,
+        ["--cellsAcross" as any]: state ? Math.pow(state.rules.size, state.rules.depth) : 9,
+      }}
+    >
       <div className="topbar">
         <div>
           <div className="title">{headline}</div>
@@ -255,9 +353,25 @@ export function App() {
         </div>
         <div className="actions">
           {status === "idle" ? (
-            <button className="btn primary" onClick={onFindMatch}>
-              Find match
-            </button>
+            <>
+              <select className="select" value={board} onChange={(e) => setBoard(Number(e.target.value))}>
+                {BOARDS.map((b, i) => (
+                  <option key={b.label} value={i}>
+                    {b.label}
+                  </option>
+                ))}
+              </select>
+              <select className="select" value={variant} onChange={(e) => setVariant(e.target.value as Variant)}>
+                {VARIANTS.map((v) => (
+                  <option key={v.variant} value={v.variant}>
+                    {v.label}
+                  </option>
+                ))}
+              </select>
+              <button className="btn primary" onClick={onFindMatch}>
+                Find match
+              </button>
+            </>
           ) : null}
           {status === "matching" ? (
             <button className="btn" onClick={onCancelMatch}>
@@ -290,55 +404,16 @@ export function App() {
             ) : (
               <span className="pill">Waiting…</span>
             )}
+            <span className="pill">{VARIANTS.find((v) => v.variant === state.rules.variant)?.label}</span>
             {allowedBoard ? (
-              <span className="pill">
-                Must play in board ({allowedBoard.bx + 1},{allowedBoard.by + 1})
-              </span>
+              <span className="pill">Must play in board ({pathLabel(allowedBoard)})</span>
             ) : (
               <span className="pill">Any board</span>
             )}
           </div>
 
           <div className="boardArea" ref={boardAreaRef}>
-            <div className="board">
-              {state.values.map((row, bx) =>
-                row.map((local, by) => {
-                  const forced = allowedBoard ? allowedBoard.bx === bx && allowedBoard.by === by : true;
-                  const playable = isPlayableBoard(local.winner);
-                  const boardClass =
-                    "localBoard" +
-                    (forced ? " localBoard-forced" : "") +
-                    (playable ? "" : " localBoard-locked");
-                  return (
-                    <div key={`${bx}-${by}`} className={boardClass}>
-                      <div className="localTop">
-                        <div className="localLabel">
-                          {bx + 1},{by + 1}
-                        </div>
-                        <div className="localWinner">
-                          {local.winner !== 2 ? `Winner: ${playerLabel(local.winner)}` : ""}
-                        </div>
-                      </div>
-                      <div className="localGrid">
-                        {local.values.map((cellsRow, cx) =>
-                          cellsRow.map((cell, cy) => (
-                            <button
-                              key={`${bx}-${by}-${cx}-${cy}`}
-                              className={cellBg(cell)}
-                              onClick={() => void onClickCell(bx, by, cx, cy)}
-                            disabled={gameEnded || !itsMyTurn || cell !== 2 || !playable || (!!allowedBoard && !forced)}
-                              title={`Board ${bx + 1},${by + 1} • Cell ${cx + 1},${cy + 1}`}
-                            >
-                              {playerLabel(cell)}
-                            </button>
-                          )),
-                        )}
-                      </div>
-                    </div>
-                  );
-                }),
-              )}
-            </div>
+            <div className="board">{renderBoards(state.values, [])}</div>
           </div>
 
           <div className="footer">
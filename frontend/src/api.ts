@@ -1,4 +1,4 @@
-import type { Move, MyState, State } from "./types";
+import type { Move, MyState, Rules, State } from "./types";
 
 async function readJson<T>(res: Response): Promise<T> {
   const text = await res.text();
@@ -13,8 +13,13 @@ async function readJson<T>(res: Response): Promise<T> {
   return JSON.parse(text) as T;
 }
 
-export async function findMatch(signal?: AbortSignal): Promise<MyState> {
-  const res = await fetch("/play", { method: "POST", signal });
+// findMatch waits for an opponent playing with the same rules; rules left out are the classic ones.
+export async function findMatch(rules: Partial<Rules>, signal?: AbortSignal): Promise<MyState> {
+  const params = new URLSearchParams();
+  for (const [name, value] of Object.entries(rules)) {
+    if (value !== undefined) params.set(name, String(value));
+  }
+  const res = await fetch(`/play?${params}`, { method: "POST", signal });
   return readJson<MyState>(res);
 }
 
@@ -3,6 +3,16 @@ export type Player = 0 | 1 | 2; // Cross=0, Circle=1, None=2
 export type LocalState = {
   values: Player[][];
   winner: Player;
+  boards?: LocalState[][]; // only on boards that contain boards (depth 3)
+};
+
+export type Variant = "standard" | "open-won-boards" | "majority" | "misere";
+
+export type Rules = {
+  size: number;
+  line: number;
+  depth: number;
+  variant: Variant;
 };
 
 export type State = {
@@ -10,18 +20,28 @@ export type State = {
   to_move: Player;
   location: number;
   winner: Player;
+  rules: Rules;
+};
+
+export type GameOptions = Rules & {
+  rated: boolean;
+  bot_level?: string; // set in games against the bot: beginner, easy, medium, hard or max
 };
 
 export type MyState = {
   game_state: State;
   role: Player;
   id: number;
+  options: GameOptions;
+  takeback: Player; // player waiting for a takeback to be accepted, None=2 if there is none
 };
 
 export type Move = {
   player: Player;
   cellX: number;
   cellY: number;
+  midX?: number; // depth 3 only
+  midY?: number;
   finalX: number;
   finalY: number;
 };